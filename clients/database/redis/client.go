@@ -3,6 +3,7 @@ package redisClient
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/balobas/sport_city_common/logger"
 	"github.com/pkg/errors"
@@ -56,6 +57,15 @@ func (c *RedisClient) SetStrWithoutExp(ctx context.Context, key string, value st
 	return nil
 }
 
+// SetNX возвращает false, если ключ уже существует
+func (c *RedisClient) SetNX(ctx context.Context, key string, value string, exp time.Duration) (bool, error) {
+	ok, err := c.client.SetNX(ctx, key, value, exp).Result()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return ok, nil
+}
+
 func (c *RedisClient) GetStr(ctx context.Context, key string) (string, error) {
 	res, err := c.client.Get(ctx, key).Result()
 	if err != nil {
@@ -111,6 +121,11 @@ func (c *RedisClient) Delete(ctx context.Context, keys ...string) error {
 	return nil
 }
 
+// Client нижележащий клиент go-redis для клиентов поверх redis (mqRedis)
+func (c *RedisClient) Client() *redis.Client {
+	return c.client
+}
+
 func (c *RedisClient) Close(ctx context.Context) error {
 	return c.client.Close()
 }
@@ -0,0 +1,55 @@
+package mqClient
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// MaxBackoffDelay потолок задержки ExponentialBackoff, если Max не задан или больше
+const MaxBackoffDelay = 24 * time.Hour
+
+/*
+ExponentialBackoff
+Initial * Multiplier^(attempt-1), но не больше Max (и не больше MaxBackoffDelay).
+Jitter (0..1) - доля задержки, на которую она случайно уменьшается.
+Общая политика повторов для консумеров (natsClient.WithBackoff) и outbox воркера
+*/
+type ExponentialBackoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+// Delay задержка перед попыткой после attempt неудачных (начиная с 1)
+func (eb ExponentialBackoff) Delay(attempt uint64) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	multiplier := eb.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	if eb.Initial <= 0 {
+		return 0
+	}
+
+	ceiling := MaxBackoffDelay
+	if eb.Max > 0 && eb.Max < ceiling {
+		ceiling = eb.Max
+	}
+
+	// при больших attempt степень переполняется до +Inf, ограничение потолком делает задержку конечной
+	delay := float64(eb.Initial) * math.Pow(multiplier, float64(attempt-1))
+	if math.IsNaN(delay) || delay > float64(ceiling) {
+		delay = float64(ceiling)
+	}
+
+	if eb.Jitter > 0 {
+		jitter := math.Min(eb.Jitter, 1)
+		delay -= delay * jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
@@ -0,0 +1,118 @@
+package mqClient
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoffDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff ExponentialBackoff
+		attempt uint64
+		want    time.Duration
+	}{
+		{
+			name:    "first attempt",
+			backoff: ExponentialBackoff{Initial: time.Second, Multiplier: 2},
+			attempt: 1,
+			want:    time.Second,
+		},
+		{
+			name:    "zero attempt treated as first",
+			backoff: ExponentialBackoff{Initial: time.Second, Multiplier: 2},
+			attempt: 0,
+			want:    time.Second,
+		},
+		{
+			name:    "grows by multiplier",
+			backoff: ExponentialBackoff{Initial: time.Second, Multiplier: 3},
+			attempt: 3,
+			want:    9 * time.Second,
+		},
+		{
+			name:    "default multiplier",
+			backoff: ExponentialBackoff{Initial: time.Second},
+			attempt: 4,
+			want:    8 * time.Second,
+		},
+		{
+			name:    "clamped to max",
+			backoff: ExponentialBackoff{Initial: time.Second, Max: 5 * time.Second, Multiplier: 2},
+			attempt: 10,
+			want:    5 * time.Second,
+		},
+		{
+			name:    "without max clamped to ceiling",
+			backoff: ExponentialBackoff{Initial: time.Second, Multiplier: 2},
+			attempt: 100,
+			want:    MaxBackoffDelay,
+		},
+		{
+			name:    "max above ceiling",
+			backoff: ExponentialBackoff{Initial: time.Second, Max: 48 * time.Hour, Multiplier: 2},
+			attempt: 100,
+			want:    MaxBackoffDelay,
+		},
+		{
+			name:    "overflow to inf",
+			backoff: ExponentialBackoff{Initial: time.Second, Max: time.Minute, Multiplier: 2},
+			attempt: math.MaxUint64,
+			want:    time.Minute,
+		},
+		{
+			name:    "zero initial",
+			backoff: ExponentialBackoff{Max: time.Minute, Multiplier: 2},
+			attempt: 5,
+			want:    0,
+		},
+		{
+			name:    "negative initial",
+			backoff: ExponentialBackoff{Initial: -time.Second, Multiplier: 2},
+			attempt: 5,
+			want:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.backoff.Delay(tt.attempt); got != tt.want {
+				t.Errorf("Delay(%d) = %s, want %s", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExponentialBackoffJitter(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff ExponentialBackoff
+		min     time.Duration
+		max     time.Duration
+	}{
+		{
+			name:    "partial jitter",
+			backoff: ExponentialBackoff{Initial: 10 * time.Second, Multiplier: 2, Jitter: 0.2},
+			min:     8 * time.Second,
+			max:     10 * time.Second,
+		},
+		{
+			name:    "jitter above one clamped",
+			backoff: ExponentialBackoff{Initial: 10 * time.Second, Multiplier: 2, Jitter: 5},
+			min:     0,
+			max:     10 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				got := tt.backoff.Delay(1)
+				if got < tt.min || got > tt.max {
+					t.Fatalf("Delay(1) = %s, want in [%s, %s]", got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
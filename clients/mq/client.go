@@ -4,6 +4,16 @@ import "context"
 
 type MqMsgHandler func(ctx context.Context, msgPayload []byte) error
 
+/*
+MqBatchHandler
+Обрабатывает батч сообщений. Результат по элементам возвращается через *BatchError,
+любая другая ошибка считается ошибкой всего батча
+*/
+type MqBatchHandler func(ctx context.Context, msgPayloads [][]byte) error
+
+// MqReplyHandler обрабатывает запрос и возвращает тело ответа
+type MqReplyHandler func(ctx context.Context, reqPayload []byte) ([]byte, error)
+
 type MqClient interface {
 	Publish(ctx context.Context, subj string, data []byte) error
 	Subscribe(ctx context.Context, handlers map[string]map[string]MqMsgHandler) error
@@ -11,4 +21,34 @@ type MqClient interface {
 	Close(ctx context.Context) error
 }
 
+/*
+Опциональные расширения MqClient. Клиенты пакета (nats, redis, postgres, memory) реализуют все,
+сторонние реализации и моки MqClient - по необходимости. Вызывать их лучше через
+PublishMessage/PublishMessages/Request/Reply: они проверяют, реализует ли клиент расширение
+*/
+
+// MsgPublisher публикация с заголовками и MsgId
+type MsgPublisher interface {
+	PublishMsg(ctx context.Context, msg PublishMsg) (PublishAck, error)
+}
+
+type BatchPublisher interface {
+	/*
+		PublishBatch
+		Публикует сообщения батчем, результаты возвращаются в порядке msgs.
+		Ошибка одного сообщения не прерывает публикацию остальных
+	*/
+	PublishBatch(ctx context.Context, msgs []PublishMsg) []PublishResult
+}
+
+type Requester interface {
+	Request(ctx context.Context, subj string, data []byte) ([]byte, error)
+	/*
+		Reply
+		Регистрирует обработчики запросов по сабжектам. Обработчики одного сабжекта
+		с одинаковой queueGroup балансируются между инстансами
+	*/
+	Reply(ctx context.Context, queueGroup string, handlers map[string]MqReplyHandler) error
+}
+
 const PubsubKey = "pubsub"
@@ -0,0 +1,104 @@
+package mqClient
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryAfterError хендлер просит повторить доставку сообщения через Delay
+type RetryAfterError struct {
+	Delay time.Duration
+	Err   error
+}
+
+func RetryAfter(delay time.Duration, err error) error {
+	return &RetryAfterError{Delay: delay, Err: err}
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("retry after %s: %v", e.Delay, e.Err)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// TerminateError хендлер просит больше не доставлять сообщение
+type TerminateError struct {
+	Err error
+}
+
+func Terminate(err error) error {
+	return &TerminateError{Err: err}
+}
+
+func (e *TerminateError) Error() string {
+	return fmt.Sprintf("terminate: %v", e.Err)
+}
+
+func (e *TerminateError) Unwrap() error {
+	return e.Err
+}
+
+func RetryDelayFromError(err error) (time.Duration, bool) {
+	var retryErr *RetryAfterError
+	if errors.As(err, &retryErr) {
+		return retryErr.Delay, true
+	}
+	return 0, false
+}
+
+func IsTerminateError(err error) bool {
+	var terminateErr *TerminateError
+	return errors.As(err, &terminateErr)
+}
+
+/*
+BatchError
+Результат обработки батча по элементам: Errors[i] - ошибка обработки i-го сообщения (nil - успешно).
+Если batch хендлер вернул другую ошибку, она относится ко всем сообщениям батча
+*/
+type BatchError struct {
+	Errors []error
+}
+
+func NewBatchError(batchSize int) *BatchError {
+	return &BatchError{Errors: make([]error, batchSize)}
+}
+
+// Set ошибка обработки i-го сообщения, может быть RetryAfter или Terminate
+func (e *BatchError) Set(i int, err error) {
+	e.Errors[i] = err
+}
+
+func (e *BatchError) Error() string {
+	var failed int
+	var firstErr error
+	for _, err := range e.Errors {
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+		}
+	}
+	return fmt.Sprintf("%d of %d batch messages failed, first: %v", failed, len(e.Errors), firstErr)
+}
+
+// BatchItemError ошибка обработки i-го сообщения батча из результата batch хендлера
+func BatchItemError(batchErr error, i int) error {
+	if batchErr == nil {
+		return nil
+	}
+
+	var itemsErr *BatchError
+	if errors.As(batchErr, &itemsErr) {
+		if i < len(itemsErr.Errors) {
+			return itemsErr.Errors[i]
+		}
+		return nil
+	}
+	return batchErr
+}
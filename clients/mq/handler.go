@@ -0,0 +1,49 @@
+package mqClient
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+type TypedMsgHandler[T any] func(ctx context.Context, payload T, meta Meta) error
+
+// Validator если payload его реализует, Validate вызывается после декодирования
+type Validator interface {
+	Validate() error
+}
+
+/*
+Handle
+Адаптер типизированного хендлера к MqMsgHandler.
+Сообщения, которые не удалось декодировать или провалидировать, терминируются (Terminate),
+так как повторная доставка их не исправит
+*/
+func Handle[T any](codec Codec, handler TypedMsgHandler[T]) MqMsgHandler {
+	return func(ctx context.Context, msgPayload []byte) error {
+		var payload T
+		if err := codec.Unmarshal(msgPayload, &payload); err != nil {
+			return Terminate(errors.Wrap(err, "failed to decode message payload"))
+		}
+
+		if validator, ok := any(payload).(Validator); ok {
+			if err := validator.Validate(); err != nil {
+				return Terminate(errors.Wrap(err, "invalid message payload"))
+			}
+		} else if validator, ok := any(&payload).(Validator); ok {
+			if err := validator.Validate(); err != nil {
+				return Terminate(errors.Wrap(err, "invalid message payload"))
+			}
+		}
+
+		return handler(ctx, payload, MetaFromCtx(ctx))
+	}
+}
+
+func HandleJSON[T any](handler TypedMsgHandler[T]) MqMsgHandler {
+	return Handle(JSONCodec{}, handler)
+}
+
+func HandleProto[T any](handler TypedMsgHandler[T]) MqMsgHandler {
+	return Handle(ProtoCodec{}, handler)
+}
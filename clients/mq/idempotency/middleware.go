@@ -0,0 +1,43 @@
+package mqIdempotency
+
+import (
+	"context"
+	"encoding/json"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	outboxEntity "github.com/balobas/sport_city_common/entity/outbox"
+	"github.com/balobas/sport_city_common/logger"
+	uuid "github.com/satori/go.uuid"
+)
+
+type Store interface {
+	// Process вызывает handle, если сообщение msgUid еще не было обработано. duplicate == true, если было
+	Process(ctx context.Context, msgUid uuid.UUID, handle func(ctx context.Context) error) (duplicate bool, err error)
+}
+
+/*
+Middleware
+Пропускает повторные доставки сообщений по BaseMsgPayload.MsgUid.
+Сообщения без msgUid обрабатываются без дедупликации
+*/
+func Middleware(store Store) mqClient.MqMiddleware {
+	return func(next mqClient.MqMsgHandler) mqClient.MqMsgHandler {
+		return func(ctx context.Context, msgPayload []byte) error {
+			log := logger.From(ctx).With().Str("component", "mqIdempotency").Logger()
+
+			var base outboxEntity.BaseMsgPayload
+			if err := json.Unmarshal(msgPayload, &base); err != nil || uuid.Equal(base.MsgUid, uuid.Nil) {
+				log.Debug().Msg("message without msgUid, handle without deduplication")
+				return next(ctx, msgPayload)
+			}
+
+			duplicate, err := store.Process(ctx, base.MsgUid, func(ctx context.Context) error {
+				return next(ctx, msgPayload)
+			})
+			if duplicate {
+				log.Info().Msgf("message %s already processed, skip", base.MsgUid)
+			}
+			return err
+		}
+	}
+}
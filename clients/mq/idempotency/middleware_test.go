@@ -0,0 +1,148 @@
+package mqIdempotency
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	outboxEntity "github.com/balobas/sport_city_common/entity/outbox"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// fakeTxManager откатывает отметки inbox, если функция транзакции вернула ошибку
+type fakeTxManager struct {
+	inbox *fakeInbox
+}
+
+func (m *fakeTxManager) ExecuteTx(ctx context.Context, isolationLevel string, f func(ctx context.Context) error) error {
+	snapshot := make(map[string]struct{}, len(m.inbox.processed))
+	for k := range m.inbox.processed {
+		snapshot[k] = struct{}{}
+	}
+	if err := f(ctx); err != nil {
+		m.inbox.processed = snapshot
+		return err
+	}
+	return nil
+}
+
+type fakeInbox struct {
+	processed map[string]struct{}
+}
+
+func (i *fakeInbox) MarkProcessed(ctx context.Context, msgUid uuid.UUID, consumer string) (bool, error) {
+	key := consumer + "/" + msgUid.String()
+	if _, ok := i.processed[key]; ok {
+		return false, nil
+	}
+	i.processed[key] = struct{}{}
+	return true, nil
+}
+
+func newPgStore(consumer string, inbox *fakeInbox) *PgStore {
+	return NewPgStore(&fakeTxManager{inbox: inbox}, inbox, consumer)
+}
+
+func mustPayload(t *testing.T, msgUid uuid.UUID) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(outboxEntity.BaseMsgPayload{MsgUid: msgUid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestMiddlewareSkipsDuplicates(t *testing.T) {
+	var calls int
+	handler := Middleware(newPgStore("consumer", &fakeInbox{processed: map[string]struct{}{}}))(
+		func(ctx context.Context, msgPayload []byte) error {
+			calls++
+			return nil
+		},
+	)
+
+	msg := mustPayload(t, uuid.NewV4())
+	for i := 0; i < 3; i++ {
+		if err := handler(context.Background(), msg); err != nil {
+			t.Fatalf("delivery %d: %v", i+1, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+
+	if err := handler(context.Background(), mustPayload(t, uuid.NewV4())); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2", calls)
+	}
+}
+
+func TestMiddlewareRetriesAfterHandlerError(t *testing.T) {
+	errHandler := errors.New("handler failed")
+
+	var calls int
+	handler := Middleware(newPgStore("consumer", &fakeInbox{processed: map[string]struct{}{}}))(
+		func(ctx context.Context, msgPayload []byte) error {
+			calls++
+			if calls == 1 {
+				return errHandler
+			}
+			return nil
+		},
+	)
+
+	msg := mustPayload(t, uuid.NewV4())
+	if err := handler(context.Background(), msg); !errors.Is(err, errHandler) {
+		t.Fatalf("first delivery err = %v, want %v", err, errHandler)
+	}
+	if err := handler(context.Background(), msg); err != nil {
+		t.Fatalf("second delivery: %v", err)
+	}
+	if err := handler(context.Background(), msg); err != nil {
+		t.Fatalf("third delivery: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2", calls)
+	}
+}
+
+func TestMiddlewareWithoutMsgUid(t *testing.T) {
+	var calls int
+	handler := Middleware(newPgStore("consumer", &fakeInbox{processed: map[string]struct{}{}}))(
+		func(ctx context.Context, msgPayload []byte) error {
+			calls++
+			return nil
+		},
+	)
+
+	for _, msg := range [][]byte{[]byte("not json"), []byte(`{"traceId":"t"}`), []byte(`{"traceId":"t"}`)} {
+		if err := handler(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("handler called %d times, want 3", calls)
+	}
+}
+
+func TestPgStoreDeduplicatesPerConsumer(t *testing.T) {
+	inbox := &fakeInbox{processed: map[string]struct{}{}}
+	msgUid := uuid.NewV4()
+	handle := func(ctx context.Context) error { return nil }
+
+	for _, consumer := range []string{"first", "second"} {
+		duplicate, err := newPgStore(consumer, inbox).Process(context.Background(), msgUid, handle)
+		if err != nil || duplicate {
+			t.Errorf("consumer %s: duplicate = %v, err = %v, want first processing", consumer, duplicate, err)
+		}
+	}
+
+	duplicate, err := newPgStore("first", inbox).Process(context.Background(), msgUid, handle)
+	if err != nil || !duplicate {
+		t.Errorf("duplicate = %v, err = %v, want duplicate", duplicate, err)
+	}
+}
@@ -0,0 +1,52 @@
+package mqIdempotency
+
+import (
+	"context"
+
+	common "github.com/balobas/sport_city_common"
+	uuid "github.com/satori/go.uuid"
+)
+
+type InboxRepository interface {
+	MarkProcessed(ctx context.Context, msgUid uuid.UUID, consumer string) (bool, error)
+}
+
+type TxManager interface {
+	ExecuteTx(ctx context.Context, isolationLevel string, f func(ctx context.Context) error) error
+}
+
+/*
+PgStore
+Запись в inbox и изменения хендлера коммитятся в одной транзакции:
+хендлер должен работать с бд через ctx, который получает
+*/
+type PgStore struct {
+	txManager       TxManager
+	inboxRepository InboxRepository
+	consumer        string
+}
+
+func NewPgStore(txManager TxManager, inboxRepository InboxRepository, consumer string) *PgStore {
+	return &PgStore{
+		txManager:       txManager,
+		inboxRepository: inboxRepository,
+		consumer:        consumer,
+	}
+}
+
+func (s *PgStore) Process(ctx context.Context, msgUid uuid.UUID, handle func(ctx context.Context) error) (bool, error) {
+	duplicate := false
+
+	err := s.txManager.ExecuteTx(ctx, common.ReadCommitted, func(ctx context.Context) error {
+		isNew, err := s.inboxRepository.MarkProcessed(ctx, msgUid, s.consumer)
+		if err != nil {
+			return err
+		}
+		if !isNew {
+			duplicate = true
+			return nil
+		}
+		return handle(ctx)
+	})
+	return duplicate, err
+}
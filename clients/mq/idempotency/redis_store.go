@@ -0,0 +1,97 @@
+package mqIdempotency
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	markerProcessing = "processing"
+	markerDone       = "done"
+
+	defaultProcessingTTL = time.Minute
+)
+
+// ErrInProgress сообщение сейчас обрабатывается другой доставкой, повторная доставка обработает его после ее завершения
+var ErrInProgress = errors.New("message is being processed by another delivery")
+
+type RedisClient interface {
+	Client() *redis.Client
+}
+
+/*
+RedisStore
+Перед обработкой пишет отметку "processing" на processingTTL, после успешной обработки
+заменяет ее на "done" на ttl. Дубликатом считается только "done": если консумер упал посреди
+обработки, отметка "processing" истечет и повторная доставка обработает сообщение.
+Если хендлер вернул ошибку, отметка удаляется
+*/
+type RedisStore struct {
+	client        *redis.Client
+	consumer      string
+	ttl           time.Duration
+	processingTTL time.Duration
+}
+
+type RedisStoreOption func(s *RedisStore)
+
+// WithProcessingTTL сколько живет отметка "processing", должно быть больше времени обработки сообщения
+func WithProcessingTTL(processingTTL time.Duration) RedisStoreOption {
+	return func(s *RedisStore) {
+		s.processingTTL = processingTTL
+	}
+}
+
+func NewRedisStore(client RedisClient, consumer string, ttl time.Duration, opts ...RedisStoreOption) *RedisStore {
+	s := &RedisStore{
+		client:        client.Client(),
+		consumer:      consumer,
+		ttl:           ttl,
+		processingTTL: defaultProcessingTTL,
+	}
+	for _, apply := range opts {
+		apply(s)
+	}
+	return s
+}
+
+func (s *RedisStore) Process(ctx context.Context, msgUid uuid.UUID, handle func(ctx context.Context) error) (bool, error) {
+	log := logger.From(ctx)
+	key := fmt.Sprintf("mq:inbox:%s:%s", s.consumer, msgUid)
+
+	isNew, err := s.client.SetNX(ctx, key, markerProcessing, s.processingTTL).Result()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	if !isNew {
+		marker, err := s.client.Get(ctx, key).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return false, errors.WithStack(err)
+		}
+		if marker == markerDone {
+			return true, nil
+		}
+		return false, errors.Wrapf(ErrInProgress, "message %s", msgUid)
+	}
+
+	// отметка обновляется и после отмены ctx хендлера
+	markCtx := context.WithoutCancel(ctx)
+
+	if err := handle(ctx); err != nil {
+		if delErr := s.client.Del(markCtx, key).Err(); delErr != nil {
+			log.Error().Err(delErr).Msgf("failed to delete inbox key %s", key)
+		}
+		return false, err
+	}
+
+	if err := s.client.Set(markCtx, key, markerDone, s.ttl).Err(); err != nil {
+		log.Error().Err(err).Msgf("failed to mark inbox key %s as done", key)
+	}
+	return false, nil
+}
@@ -0,0 +1,341 @@
+package mqMemory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrNoResponders   = errors.New("no responders for request")
+	ErrStreamNotFound = errors.New("stream not found")
+	ErrClientClosed   = errors.New("memory mq client closed")
+)
+
+const defaultRedeliveryDelay = 10 * time.Millisecond
+
+/*
+Client
+Реализация mqClient.MqClient в памяти процесса для тестов.
+Стримы и консумеры объявляются через AddStream/AddConsumer, дальше
+Subscribe/SubscribeV2 работают с ними так же, как nats клиенты:
+
+	c := mqMemory.New()
+	c.AddStream("media", "media.*")
+	c.AddConsumer("media", "media_usage_consumer", "media.usage")
+	c.SubscribeV2(ctx, map[string]map[string]mqClient.MqMsgHandler{
+		"media": {"media_usage_consumer": handler},
+	})
+*/
+type Client struct {
+	opts options
+
+	mx            sync.Mutex
+	streams       map[string]*stream
+	subscriptions []subscription
+	replyHandlers []replyHandler
+	published     []mqClient.PublishMsg
+	pubFailures   []*injectedFailure
+	changed       chan struct{}
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type options struct {
+	redeliveryDelay time.Duration
+	maxDeliver      int
+	middlewares     []mqClient.MqMiddleware
+}
+
+type Option func(opts *options)
+
+// WithRedeliveryDelay задержка повторной доставки, если хендлер не запросил свою (mqClient.RetryAfter)
+func WithRedeliveryDelay(delay time.Duration) Option {
+	return func(opts *options) {
+		opts.redeliveryDelay = delay
+	}
+}
+
+// WithMaxDeliver после maxDeliver неудачных доставок сообщение терминируется
+func WithMaxDeliver(maxDeliver int) Option {
+	return func(opts *options) {
+		opts.maxDeliver = maxDeliver
+	}
+}
+
+// WithMiddlewares middlewares для всех подписок и консумеров клиента
+func WithMiddlewares(middlewares ...mqClient.MqMiddleware) Option {
+	return func(opts *options) {
+		opts.middlewares = append(opts.middlewares, middlewares...)
+	}
+}
+
+type subscription struct {
+	ctx     context.Context
+	subject string
+	handler mqClient.MqMsgHandler
+}
+
+type replyHandler struct {
+	ctx     context.Context
+	subject string
+	handler mqClient.MqReplyHandler
+}
+
+type injectedFailure struct {
+	subject string
+	err     error
+	times   int
+}
+
+func New(opts ...Option) *Client {
+	c := &Client{
+		opts: options{
+			redeliveryDelay: defaultRedeliveryDelay,
+		},
+		streams: map[string]*stream{},
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	for _, apply := range opts {
+		apply(&c.opts)
+	}
+	return c
+}
+
+func (c *Client) AddStream(name string, subjects ...string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if s, ok := c.streams[name]; ok {
+		s.subjects = subjects
+		return
+	}
+	c.streams[name] = newStream(name, subjects)
+}
+
+// AddConsumer без filterSubjects консумер получает все сообщения стрима
+func (c *Client) AddConsumer(streamName string, consumerName string, filterSubjects ...string) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	s, ok := c.streams[streamName]
+	if !ok {
+		return errors.Wrap(ErrStreamNotFound, streamName)
+	}
+	if cons, ok := s.consumers[consumerName]; ok {
+		cons.filters = filterSubjects
+		return nil
+	}
+	s.consumers[consumerName] = newConsumer(c, streamName, consumerName, filterSubjects)
+	return nil
+}
+
+func (c *Client) Publish(ctx context.Context, subj string, data []byte) error {
+	_, err := c.PublishMsg(ctx, mqClient.PublishMsg{
+		Subject: subj,
+		Data:    data,
+	})
+	return err
+}
+
+func (c *Client) PublishMsg(ctx context.Context, msg mqClient.PublishMsg) (mqClient.PublishAck, error) {
+	c.mx.Lock()
+	if c.closedLocked() {
+		c.mx.Unlock()
+		return mqClient.PublishAck{}, errors.WithStack(ErrClientClosed)
+	}
+
+	for _, failure := range c.pubFailures {
+		if failure.times > 0 && mqClient.SubjectMatches(failure.subject, msg.Subject) {
+			failure.times--
+			c.mx.Unlock()
+			return mqClient.PublishAck{}, failure.err
+		}
+	}
+
+	c.published = append(c.published, msg)
+
+	var ack mqClient.PublishAck
+	for _, s := range c.streams {
+		if !mqClient.SubjectMatchesAny(s.subjects, msg.Subject) {
+			continue
+		}
+		ack = s.append(msg)
+		break
+	}
+
+	var subs []subscription
+	for _, sub := range c.subscriptions {
+		if mqClient.SubjectMatches(sub.subject, msg.Subject) {
+			subs = append(subs, sub)
+		}
+	}
+	c.notifyChangedLocked()
+	// wg.Add под мьютексом: Close закрывает done под ним же, поэтому не может уже ждать в wg.Wait
+	c.wg.Add(len(subs))
+	c.mx.Unlock()
+
+	for _, sub := range subs {
+		go func(sub subscription) {
+			defer c.wg.Done()
+			ctx := mqClient.ContextWithMeta(sub.ctx, mqClient.Meta{
+				Subject: msg.Subject,
+				Headers: msg.Headers,
+			})
+			callHandler(ctx, sub.handler, msg.Data)
+		}(sub)
+	}
+	return ack, nil
+}
+
+func (c *Client) PublishBatch(ctx context.Context, msgs []mqClient.PublishMsg) []mqClient.PublishResult {
+	results := make([]mqClient.PublishResult, len(msgs))
+	for i, msg := range msgs {
+		results[i].Ack, results[i].Err = c.PublishMsg(ctx, msg)
+	}
+	return results
+}
+
+/*
+Subscribe
+handlers[mqClient.PubsubKey] - подписки без стрима по сабжектам,
+остальные ключи - стримы, для каждого сабжекта создается консумер с именем сабжекта
+*/
+func (c *Client) Subscribe(ctx context.Context, handlers map[string]map[string]mqClient.MqMsgHandler) error {
+	for streamName, subjectHandlers := range handlers {
+		if streamName == mqClient.PubsubKey {
+			c.mx.Lock()
+			for subject, handler := range subjectHandlers {
+				c.subscriptions = append(c.subscriptions, subscription{
+					ctx:     ctx,
+					subject: subject,
+					handler: mqClient.Chain(handler, c.opts.middlewares...),
+				})
+			}
+			c.mx.Unlock()
+			continue
+		}
+
+		for subject, handler := range subjectHandlers {
+			if err := c.subscribeConsumer(ctx, streamName, subject, []string{subject}, handler); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Client) SubscribeV2(ctx context.Context, streamsConsumers map[string]map[string]mqClient.MqMsgHandler) (subErr error) {
+	for streamName, consumers := range streamsConsumers {
+		for consumerName, handler := range consumers {
+			if err := c.subscribeConsumer(ctx, streamName, consumerName, nil, handler); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Client) subscribeConsumer(
+	ctx context.Context,
+	streamName string,
+	consumerName string,
+	filters []string,
+	handler mqClient.MqMsgHandler,
+) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	s, ok := c.streams[streamName]
+	if !ok {
+		return errors.Wrap(ErrStreamNotFound, streamName)
+	}
+
+	cons, ok := s.consumers[consumerName]
+	if !ok {
+		cons = newConsumer(c, streamName, consumerName, filters)
+		s.consumers[consumerName] = cons
+	}
+	cons.start(ctx, mqClient.Chain(handler, c.opts.middlewares...))
+	return nil
+}
+
+func (c *Client) Request(ctx context.Context, subj string, data []byte) ([]byte, error) {
+	c.mx.Lock()
+	var (
+		handler replyHandler
+		found   bool
+	)
+	for _, h := range c.replyHandlers {
+		if mqClient.SubjectMatches(h.subject, subj) {
+			handler, found = h, true
+			break
+		}
+	}
+	c.mx.Unlock()
+
+	if !found {
+		return nil, errors.WithStack(ErrNoResponders)
+	}
+
+	reqCtx := mqClient.ContextWithMeta(handler.ctx, mqClient.Meta{Subject: subj})
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithDeadline(reqCtx, deadline)
+		defer cancel()
+	}
+	return handler.handler(reqCtx, data)
+}
+
+func (c *Client) Reply(ctx context.Context, queueGroup string, handlers map[string]mqClient.MqReplyHandler) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	for subject, handler := range handlers {
+		c.replyHandlers = append(c.replyHandlers, replyHandler{
+			ctx:     ctx,
+			subject: subject,
+			handler: handler,
+		})
+	}
+	return nil
+}
+
+func (c *Client) Close(ctx context.Context) error {
+	c.mx.Lock()
+	if !c.closedLocked() {
+		close(c.done)
+	}
+	c.mx.Unlock()
+
+	c.wg.Wait()
+	return nil
+}
+
+func (c *Client) closedLocked() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Client) notifyChangedLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func callHandler(ctx context.Context, handler mqClient.MqMsgHandler, data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("handler panic: %v", r)
+		}
+	}()
+	return handler(ctx, data)
+}
@@ -0,0 +1,335 @@
+package mqMemory
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/pkg/errors"
+)
+
+func newTestClient(t *testing.T, opts ...Option) *Client {
+	t.Helper()
+
+	c := New(append([]Option{WithRedeliveryDelay(time.Millisecond)}, opts...)...)
+	c.AddStream("media", "media.>")
+	if err := c.AddConsumer("media", "usage_consumer", "media.usage"); err != nil {
+		t.Fatalf("AddConsumer: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = c.Close(context.Background())
+	})
+	return c
+}
+
+func waitCtx(t *testing.T) context.Context {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func subscribeUsage(t *testing.T, c *Client, handler mqClient.MqMsgHandler) {
+	t.Helper()
+
+	err := c.SubscribeV2(context.Background(), map[string]map[string]mqClient.MqMsgHandler{
+		"media": {"usage_consumer": handler},
+	})
+	if err != nil {
+		t.Fatalf("SubscribeV2: %v", err)
+	}
+}
+
+func TestConsumerReceivesOnlyFilteredSubjects(t *testing.T) {
+	c := newTestClient(t)
+
+	var (
+		mx       sync.Mutex
+		subjects []string
+	)
+	subscribeUsage(t, c, func(ctx context.Context, msgPayload []byte) error {
+		mx.Lock()
+		subjects = append(subjects, mqClient.MetaFromCtx(ctx).Subject)
+		mx.Unlock()
+		return nil
+	})
+
+	ctx := waitCtx(t)
+	for _, subj := range []string{"media.usage", "media.deleted", "media.usage"} {
+		if err := c.Publish(ctx, subj, []byte(subj)); err != nil {
+			t.Fatalf("Publish(%s): %v", subj, err)
+		}
+	}
+
+	if err := c.WaitDelivered(ctx, "media", "usage_consumer", 2); err != nil {
+		t.Fatal(err)
+	}
+	if acked := c.Acked("media", "usage_consumer"); len(acked) != 2 {
+		t.Errorf("acked = %d messages, want 2", len(acked))
+	}
+
+	mx.Lock()
+	defer mx.Unlock()
+	for _, subj := range subjects {
+		if subj != "media.usage" {
+			t.Errorf("consumer received %s", subj)
+		}
+	}
+	if published := c.Published("media.>"); len(published) != 3 {
+		t.Errorf("published = %d messages, want 3", len(published))
+	}
+}
+
+func TestPublishDeduplicatesByMsgId(t *testing.T) {
+	c := newTestClient(t)
+	ctx := waitCtx(t)
+
+	msg := mqClient.PublishMsg{Subject: "media.usage", Data: []byte("1"), MsgId: "msg-1"}
+	first, err := c.PublishMsg(ctx, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.PublishMsg(ctx, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Duplicate || !second.Duplicate {
+		t.Errorf("duplicate flags = %v, %v, want false, true", first.Duplicate, second.Duplicate)
+	}
+	if first.Sequence != second.Sequence || first.Stream != "media" {
+		t.Errorf("acks = %+v, %+v", first, second)
+	}
+}
+
+func TestFailedDeliveryRedelivered(t *testing.T) {
+	c := newTestClient(t)
+
+	var calls atomic.Int32
+	subscribeUsage(t, c, func(ctx context.Context, msgPayload []byte) error {
+		if calls.Add(1) < 3 {
+			return errors.New("temporary failure")
+		}
+		if n := mqClient.MetaFromCtx(ctx).NumDelivered; n != 3 {
+			t.Errorf("NumDelivered = %d, want 3", n)
+		}
+		return nil
+	})
+
+	ctx := waitCtx(t)
+	if err := c.Publish(ctx, "media.usage", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WaitDelivered(ctx, "media", "usage_consumer", 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Acked("media", "usage_consumer")) != 1 || calls.Load() != 3 {
+		t.Errorf("acked = %d, calls = %d, want 1 and 3", len(c.Acked("media", "usage_consumer")), calls.Load())
+	}
+}
+
+func TestTerminatedDeliveries(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		handler mqClient.MqMsgHandler
+	}{
+		{
+			name: "terminate error",
+			handler: func(ctx context.Context, msgPayload []byte) error {
+				return mqClient.Terminate(errors.New("invalid message"))
+			},
+		},
+		{
+			name: "max deliver exhausted",
+			opts: []Option{WithMaxDeliver(2)},
+			handler: func(ctx context.Context, msgPayload []byte) error {
+				return errors.New("always fails")
+			},
+		},
+		{
+			name: "handler panic",
+			opts: []Option{WithMaxDeliver(1)},
+			handler: func(ctx context.Context, msgPayload []byte) error {
+				panic("boom")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, tt.opts...)
+			subscribeUsage(t, c, tt.handler)
+
+			ctx := waitCtx(t)
+			if err := c.Publish(ctx, "media.usage", []byte("1")); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.WaitDelivered(ctx, "media", "usage_consumer", 1); err != nil {
+				t.Fatal(err)
+			}
+			if terminated := c.Terminated("media", "usage_consumer"); len(terminated) != 1 {
+				t.Errorf("terminated = %d messages, want 1", len(terminated))
+			}
+			if acked := c.Acked("media", "usage_consumer"); len(acked) != 0 {
+				t.Errorf("acked = %d messages, want 0", len(acked))
+			}
+		})
+	}
+}
+
+func TestInjectedFailures(t *testing.T) {
+	c := newTestClient(t, WithMaxDeliver(1))
+	ctx := waitCtx(t)
+
+	errBroker := errors.New("broker down")
+	c.InjectPublishFailure("media.*", errBroker, 1)
+	if err := c.Publish(ctx, "media.usage", []byte("1")); !errors.Is(err, errBroker) {
+		t.Fatalf("first Publish err = %v, want %v", err, errBroker)
+	}
+	if len(c.Published("media.usage")) != 0 {
+		t.Error("failed publish recorded as published")
+	}
+
+	if err := c.InjectHandlerFailure("media", "usage_consumer", errors.New("handler down"), 1); err != nil {
+		t.Fatal(err)
+	}
+	var calls atomic.Int32
+	subscribeUsage(t, c, func(ctx context.Context, msgPayload []byte) error {
+		calls.Add(1)
+		return nil
+	})
+
+	if err := c.Publish(ctx, "media.usage", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Publish(ctx, "media.usage", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WaitDelivered(ctx, "media", "usage_consumer", 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Terminated("media", "usage_consumer")) != 1 || len(c.Acked("media", "usage_consumer")) != 1 || calls.Load() != 1 {
+		t.Errorf("terminated = %d, acked = %d, calls = %d, want 1, 1, 1",
+			len(c.Terminated("media", "usage_consumer")), len(c.Acked("media", "usage_consumer")), calls.Load())
+	}
+}
+
+func TestPubsubSubscription(t *testing.T) {
+	c := newTestClient(t)
+
+	received := make(chan mqClient.Meta, 1)
+	err := c.Subscribe(context.Background(), map[string]map[string]mqClient.MqMsgHandler{
+		mqClient.PubsubKey: {
+			"events.*": func(ctx context.Context, msgPayload []byte) error {
+				received <- mqClient.MetaFromCtx(ctx)
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := waitCtx(t)
+	_, err = c.PublishMsg(ctx, mqClient.PublishMsg{
+		Subject: "events.created",
+		Headers: map[string][]string{"X-Test": {"1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case meta := <-received:
+		if meta.Subject != "events.created" || meta.Header("X-Test") != "1" {
+			t.Errorf("meta = %+v", meta)
+		}
+	case <-ctx.Done():
+		t.Fatal("pubsub message not received")
+	}
+}
+
+func TestRequestReply(t *testing.T) {
+	c := newTestClient(t)
+	ctx := waitCtx(t)
+
+	if _, err := c.Request(ctx, "svc.lookup", nil); !errors.Is(err, ErrNoResponders) {
+		t.Fatalf("Request without responders err = %v, want ErrNoResponders", err)
+	}
+
+	err := c.Reply(context.Background(), "", map[string]mqClient.MqReplyHandler{
+		"svc.*": func(ctx context.Context, reqPayload []byte) ([]byte, error) {
+			return append([]byte("re:"), reqPayload...), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.Request(ctx, "svc.lookup", []byte("ping"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != "re:ping" {
+		t.Errorf("resp = %q, want %q", resp, "re:ping")
+	}
+}
+
+func TestPublishAfterClose(t *testing.T) {
+	c := newTestClient(t)
+	subscribeUsage(t, c, func(ctx context.Context, msgPayload []byte) error {
+		return errors.New("always fails")
+	})
+
+	ctx := waitCtx(t)
+	if err := c.Publish(ctx, "media.usage", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// повторный Close не паникует
+	if err := c.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Publish(ctx, "media.usage", []byte("2")); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("Publish after Close err = %v, want ErrClientClosed", err)
+	}
+}
+
+func TestConcurrentPublishAndClose(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		c := New(WithRedeliveryDelay(time.Millisecond))
+		err := c.Subscribe(context.Background(), map[string]map[string]mqClient.MqMsgHandler{
+			mqClient.PubsubKey: {
+				"events.>": func(ctx context.Context, msgPayload []byte) error { return nil },
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for k := 0; k < 100; k++ {
+					if err := c.Publish(context.Background(), "events.created", nil); errors.Is(err, ErrClientClosed) {
+						return
+					}
+				}
+			}()
+		}
+		if err := c.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		wg.Wait()
+	}
+}
@@ -0,0 +1,103 @@
+package mqMemory
+
+import (
+	"context"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/pkg/errors"
+)
+
+// Published опубликованные сообщения, сабжект которых подходит под subjectPattern (в порядке публикации)
+func (c *Client) Published(subjectPattern string) []mqClient.PublishMsg {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	var res []mqClient.PublishMsg
+	for _, msg := range c.published {
+		if mqClient.SubjectMatches(subjectPattern, msg.Subject) {
+			res = append(res, msg)
+		}
+	}
+	return res
+}
+
+// Acked данные сообщений, успешно обработанных консумером
+func (c *Client) Acked(streamName string, consumerName string) [][]byte {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	cons, ok := c.consumerLocked(streamName, consumerName)
+	if !ok {
+		return nil
+	}
+	return append([][]byte(nil), cons.acked...)
+}
+
+// Terminated данные сообщений, которые больше не будут доставлены (Terminate или max deliver)
+func (c *Client) Terminated(streamName string, consumerName string) [][]byte {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	cons, ok := c.consumerLocked(streamName, consumerName)
+	if !ok {
+		return nil
+	}
+	return append([][]byte(nil), cons.terminated...)
+}
+
+// WaitDelivered ждет, пока консумер завершит обработку (ack или terminate) n сообщений
+func (c *Client) WaitDelivered(ctx context.Context, streamName string, consumerName string, n int) error {
+	for {
+		c.mx.Lock()
+		cons, ok := c.consumerLocked(streamName, consumerName)
+		if ok && len(cons.acked)+len(cons.terminated) >= n {
+			c.mx.Unlock()
+			return nil
+		}
+		changed := c.changed
+		c.mx.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "consumer %s on stream %s: waiting for %d messages", consumerName, streamName, n)
+		}
+	}
+}
+
+// InjectPublishFailure следующие times публикаций в subjectPattern вернут err
+func (c *Client) InjectPublishFailure(subjectPattern string, err error, times int) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.pubFailures = append(c.pubFailures, &injectedFailure{
+		subject: subjectPattern,
+		err:     err,
+		times:   times,
+	})
+}
+
+// InjectHandlerFailure следующие times доставок консумеру завершатся err без вызова хендлера
+func (c *Client) InjectHandlerFailure(streamName string, consumerName string, err error, times int) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	cons, ok := c.consumerLocked(streamName, consumerName)
+	if !ok {
+		return errors.Errorf("consumer %s on stream %s not found", consumerName, streamName)
+	}
+	cons.hdlrFailures = append(cons.hdlrFailures, &injectedFailure{
+		err:   err,
+		times: times,
+	})
+	return nil
+}
+
+func (c *Client) consumerLocked(streamName string, consumerName string) (*consumer, bool) {
+	s, ok := c.streams[streamName]
+	if !ok {
+		return nil, false
+	}
+	cons, ok := s.consumers[consumerName]
+	return cons, ok
+}
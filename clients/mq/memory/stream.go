@@ -0,0 +1,195 @@
+package mqMemory
+
+import (
+	"context"
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+)
+
+type stream struct {
+	name      string
+	subjects  []string
+	seq       uint64
+	msgIds    map[string]uint64
+	consumers map[string]*consumer
+}
+
+func newStream(name string, subjects []string) *stream {
+	return &stream{
+		name:      name,
+		subjects:  subjects,
+		msgIds:    map[string]uint64{},
+		consumers: map[string]*consumer{},
+	}
+}
+
+// append вызывается под мьютексом клиента
+func (s *stream) append(msg mqClient.PublishMsg) mqClient.PublishAck {
+	if len(msg.MsgId) != 0 {
+		if seq, ok := s.msgIds[msg.MsgId]; ok {
+			return mqClient.PublishAck{Stream: s.name, Sequence: seq, Duplicate: true}
+		}
+	}
+
+	s.seq++
+	if len(msg.MsgId) != 0 {
+		s.msgIds[msg.MsgId] = s.seq
+	}
+
+	for _, cons := range s.consumers {
+		if len(cons.filters) != 0 && !mqClient.SubjectMatchesAny(cons.filters, msg.Subject) {
+			continue
+		}
+		cons.enqueueLocked(&message{
+			subject:   msg.Subject,
+			data:      msg.Data,
+			headers:   msg.Headers,
+			streamSeq: s.seq,
+			timestamp: time.Now().UTC(),
+		})
+	}
+	return mqClient.PublishAck{Stream: s.name, Sequence: s.seq}
+}
+
+type message struct {
+	subject      string
+	data         []byte
+	headers      map[string][]string
+	streamSeq    uint64
+	numDelivered uint64
+	timestamp    time.Time
+}
+
+type consumer struct {
+	client  *Client
+	stream  string
+	name    string
+	filters []string
+
+	handler     mqClient.MqMsgHandler
+	started     bool
+	pending     []*message
+	notify      chan struct{}
+	consumerSeq uint64
+
+	acked        [][]byte
+	terminated   [][]byte
+	hdlrFailures []*injectedFailure
+}
+
+func newConsumer(c *Client, streamName string, name string, filters []string) *consumer {
+	return &consumer{
+		client:  c,
+		stream:  streamName,
+		name:    name,
+		filters: filters,
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+func (cons *consumer) enqueueLocked(msg *message) {
+	cons.pending = append(cons.pending, msg)
+	select {
+	case cons.notify <- struct{}{}:
+	default:
+	}
+}
+
+// enqueue повторная доставка по таймеру, после Close сообщение отбрасывается
+func (cons *consumer) enqueue(msg *message) {
+	cons.client.mx.Lock()
+	defer cons.client.mx.Unlock()
+
+	if cons.client.closedLocked() {
+		return
+	}
+	cons.enqueueLocked(msg)
+}
+
+// start вызывается под мьютексом клиента
+func (cons *consumer) start(ctx context.Context, handler mqClient.MqMsgHandler) {
+	cons.handler = handler
+	if cons.started || cons.client.closedLocked() {
+		return
+	}
+	cons.started = true
+
+	cons.client.wg.Add(1)
+	go func() {
+		defer cons.client.wg.Done()
+		for {
+			cons.client.mx.Lock()
+			if len(cons.pending) == 0 {
+				cons.client.mx.Unlock()
+				select {
+				case <-cons.notify:
+					continue
+				case <-ctx.Done():
+					return
+				case <-cons.client.done:
+					return
+				}
+			}
+			msg := cons.pending[0]
+			cons.pending = cons.pending[1:]
+			cons.client.mx.Unlock()
+
+			cons.deliver(ctx, msg)
+		}
+	}()
+}
+
+func (cons *consumer) deliver(ctx context.Context, msg *message) {
+	c := cons.client
+
+	c.mx.Lock()
+	msg.numDelivered++
+	cons.consumerSeq++
+	handler := cons.handler
+	meta := mqClient.Meta{
+		Subject:      msg.subject,
+		Headers:      msg.headers,
+		Stream:       cons.stream,
+		Consumer:     cons.name,
+		NumDelivered: msg.numDelivered,
+		StreamSeq:    msg.streamSeq,
+		ConsumerSeq:  cons.consumerSeq,
+		Timestamp:    msg.timestamp,
+	}
+
+	var err error
+	for _, failure := range cons.hdlrFailures {
+		if failure.times > 0 {
+			failure.times--
+			err = failure.err
+			break
+		}
+	}
+	c.mx.Unlock()
+
+	if err == nil {
+		err = callHandler(mqClient.ContextWithMeta(ctx, meta), handler, msg.data)
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	defer c.notifyChangedLocked()
+
+	switch {
+	case err == nil:
+		cons.acked = append(cons.acked, msg.data)
+	case mqClient.IsTerminateError(err):
+		cons.terminated = append(cons.terminated, msg.data)
+	case c.opts.maxDeliver > 0 && msg.numDelivered >= uint64(c.opts.maxDeliver):
+		cons.terminated = append(cons.terminated, msg.data)
+	default:
+		delay, ok := mqClient.RetryDelayFromError(err)
+		if !ok {
+			delay = c.opts.redeliveryDelay
+		}
+		time.AfterFunc(delay, func() {
+			cons.enqueue(msg)
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package mqClient
+
+import (
+	"context"
+	"time"
+)
+
+// Meta метаданные сообщения, которые клиент кладет в ctx перед вызовом MqMsgHandler
+type Meta struct {
+	Subject      string
+	Headers      map[string][]string
+	Stream       string
+	Consumer     string
+	NumDelivered uint64
+	StreamSeq    uint64
+	ConsumerSeq  uint64
+	Timestamp    time.Time
+}
+
+func (m Meta) Header(key string) string {
+	if vals := m.Headers[key]; len(vals) != 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+type metaCtxKey struct{}
+
+func ContextWithMeta(ctx context.Context, meta Meta) context.Context {
+	return context.WithValue(ctx, metaCtxKey{}, meta)
+}
+
+func MetaFromCtx(ctx context.Context) Meta {
+	meta, ok := ctx.Value(metaCtxKey{}).(Meta)
+	if !ok {
+		return Meta{}
+	}
+	return meta
+}
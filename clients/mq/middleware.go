@@ -0,0 +1,12 @@
+package mqClient
+
+// MqMiddleware оборачивает обработчик сообщений, аналог grpc interceptor
+type MqMiddleware func(next MqMsgHandler) MqMsgHandler
+
+// Chain оборачивает handler в middlewares, первый middleware вызывается первым
+func Chain(handler MqMsgHandler, middlewares ...MqMiddleware) MqMsgHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
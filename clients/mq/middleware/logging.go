@@ -0,0 +1,92 @@
+package mqMiddleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/balobas/sport_city_common/logger"
+)
+
+func Logging(opts ...LoggingOption) mqClient.MqMiddleware {
+	var op loggingOptions
+
+	for _, opt := range opts {
+		opt(&op)
+	}
+
+	return func(next mqClient.MqMsgHandler) mqClient.MqMsgHandler {
+		return func(ctx context.Context, msgPayload []byte) error {
+			meta := mqClient.MetaFromCtx(ctx)
+
+			log := logger.From(ctx).With().Fields(map[string]interface{}{
+				"subject":  meta.Subject,
+				"stream":   meta.Stream,
+				"consumer": meta.Consumer,
+			}).Logger()
+			ctx = logger.ContextWithLogger(ctx, log)
+
+			logMsgFields := map[string]interface{}{
+				"num_delivered": meta.NumDelivered,
+			}
+			if op.withPayload {
+				logMsgFields["payload"] = string(msgPayload)
+			}
+
+			log.Info().
+				Timestamp().
+				Fields(logMsgFields).
+				Msg("incoming message")
+			t1 := time.Now()
+
+			err := next(ctx, msgPayload)
+
+			logResultFields := map[string]interface{}{
+				"latency_ms": float64(time.Since(t1).Nanoseconds()) / 1000000.0,
+			}
+			if err != nil {
+				logResultFields["error"] = err.Error()
+
+				if op.shouldLogError(err) {
+					log.Error().Err(err).Send()
+				}
+			}
+
+			log.Info().
+				Timestamp().
+				Fields(logResultFields).
+				Msg("incoming message handled")
+
+			return err
+		}
+	}
+}
+
+type loggingOptions struct {
+	withPayload      bool
+	withoutLogErrors []error
+}
+
+type LoggingOption func(opts *loggingOptions)
+
+func WithPayloadLog() LoggingOption {
+	return func(opts *loggingOptions) {
+		opts.withPayload = true
+	}
+}
+
+func WithoutLogErrors(errs ...error) LoggingOption {
+	return func(opts *loggingOptions) {
+		opts.withoutLogErrors = errs
+	}
+}
+
+func (opts *loggingOptions) shouldLogError(err error) bool {
+	for _, e := range opts.withoutLogErrors {
+		if errors.Is(err, e) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,25 @@
+package mqMiddleware
+
+import (
+	"context"
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+)
+
+// MetricsRecorder реализуется сервисом поверх его системы метрик (prometheus, otel и т.д.)
+type MetricsRecorder interface {
+	ObserveMessageHandled(meta mqClient.Meta, duration time.Duration, err error)
+}
+
+// Metrics передает в recorder длительность и результат обработки каждого сообщения
+func Metrics(recorder MetricsRecorder) mqClient.MqMiddleware {
+	return func(next mqClient.MqMsgHandler) mqClient.MqMsgHandler {
+		return func(ctx context.Context, msgPayload []byte) error {
+			t1 := time.Now()
+			err := next(ctx, msgPayload)
+			recorder.ObserveMessageHandled(mqClient.MetaFromCtx(ctx), time.Since(t1), err)
+			return err
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package mqMiddleware
+
+import (
+	"context"
+	"runtime/debug"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/pkg/errors"
+)
+
+// Recovery превращает панику хендлера в ошибку, сообщение уходит на повторную доставку
+func Recovery() mqClient.MqMiddleware {
+	return func(next mqClient.MqMsgHandler) mqClient.MqMsgHandler {
+		return func(ctx context.Context, msgPayload []byte) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					meta := mqClient.MetaFromCtx(ctx)
+					log := logger.From(ctx)
+					log.Error().
+						Str("subject", meta.Subject).
+						Str("stack", string(debug.Stack())).
+						Msgf("mq handler panic: %v", r)
+					err = errors.Errorf("handler panic: %v", r)
+				}
+			}()
+			return next(ctx, msgPayload)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package mqMiddleware
+
+import (
+	"context"
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/pkg/errors"
+)
+
+// Timeout ограничивает время обработки сообщения, хендлер должен учитывать ctx
+func Timeout(timeout time.Duration) mqClient.MqMiddleware {
+	return func(next mqClient.MqMsgHandler) mqClient.MqMsgHandler {
+		return func(ctx context.Context, msgPayload []byte) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			err := next(ctx, msgPayload)
+			if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return errors.Wrapf(err, "message handling timeout %s exceeded", timeout)
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package mqMiddleware
+
+import (
+	"context"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/balobas/sport_city_common/tracer"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const traceParentHeader = "traceparent"
+
+// headersCarrier адаптер заголовков сообщения к propagation.TextMapCarrier (ключи без канонизации, как в nats)
+type headersCarrier map[string][]string
+
+func (c headersCarrier) Get(key string) string {
+	if v := c[key]; len(v) != 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c headersCarrier) Set(key string, value string) {
+	c[key] = []string{value}
+}
+
+func (c headersCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+/*
+Tracing
+Продолжает трейс продюсера из заголовков сообщения (или из traceId в payload для старых продюсеров)
+и оборачивает обработку в consumer span. Если spanName пустой, используется сабжект сообщения
+*/
+func Tracing(spanName string) mqClient.MqMiddleware {
+	return func(next mqClient.MqMsgHandler) mqClient.MqMsgHandler {
+		return func(ctx context.Context, msgPayload []byte) error {
+			meta := mqClient.MetaFromCtx(ctx)
+
+			if len(headersCarrier(meta.Headers).Get(traceParentHeader)) != 0 {
+				ctx = tracer.Propagator().Extract(ctx, headersCarrier(meta.Headers))
+			} else {
+				var err error
+				ctx, err = mqClient.ContextWithPayloadTraceId(ctx, msgPayload)
+				if err != nil {
+					log := logger.From(ctx)
+					log.Warn().Str("error", err.Error()).Msg("failed to get traceID from message")
+				}
+			}
+
+			name := spanName
+			if len(name) == 0 {
+				name = meta.Subject
+			}
+
+			ctx, span := tracer.FromCtx(ctx).Start(ctx, name, trace.WithSpanKind(trace.SpanKindConsumer))
+			defer span.End()
+
+			err := next(ctx, msgPayload)
+			if err != nil {
+				span.RecordError(err, trace.WithAttributes(
+					attribute.String("message", "failed to handle message"),
+				))
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package natsClient
+
+import (
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+)
+
+const defaultNackDelay = 1 * time.Second
+
+// BackoffPolicy возвращает задержку перед повторной доставкой по номеру доставки (начиная с 1)
+type BackoffPolicy interface {
+	Delay(numDelivered uint64) time.Duration
+}
+
+type FixedBackoff time.Duration
+
+func (fb FixedBackoff) Delay(numDelivered uint64) time.Duration {
+	return time.Duration(fb)
+}
+
+// ExponentialBackoff см. mqClient.ExponentialBackoff
+type ExponentialBackoff = mqClient.ExponentialBackoff
+
+// ScheduleBackoff задержка по номеру доставки, для доставок после конца расписания берется последняя
+type ScheduleBackoff []time.Duration
+
+func (sb ScheduleBackoff) Delay(numDelivered uint64) time.Duration {
+	if len(sb) == 0 {
+		return defaultNackDelay
+	}
+	if numDelivered < 1 {
+		numDelivered = 1
+	}
+	if numDelivered > uint64(len(sb)) {
+		return sb[len(sb)-1]
+	}
+	return sb[numDelivered-1]
+}
+
+type natsJsOptionBackoff struct {
+	policy BackoffPolicy
+}
+
+func (nb *natsJsOptionBackoff) Apply(opt *NatsClientJsOpts) {
+	opt.backoff = nb.policy
+}
+
+// WithBackoff задает задержку перед повторной доставкой сообщений, обработка которых завершилась ошибкой
+func WithBackoff(policy BackoffPolicy) NatsClientJetStreamOption {
+	return &natsJsOptionBackoff{policy: policy}
+}
+
+func (nc *NatsClientJetStream) nackDelay(numDelivered uint64) time.Duration {
+	if nc.opts.backoff == nil {
+		return defaultNackDelay
+	}
+	return nc.opts.backoff.Delay(numDelivered)
+}
@@ -0,0 +1,47 @@
+package natsClient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleBackoffDelay(t *testing.T) {
+	schedule := ScheduleBackoff{time.Second, 5 * time.Second, time.Minute}
+
+	tests := []struct {
+		numDelivered uint64
+		want         time.Duration
+	}{
+		{numDelivered: 0, want: time.Second},
+		{numDelivered: 1, want: time.Second},
+		{numDelivered: 2, want: 5 * time.Second},
+		{numDelivered: 3, want: time.Minute},
+		{numDelivered: 10, want: time.Minute},
+	}
+	for _, tt := range tests {
+		if got := schedule.Delay(tt.numDelivered); got != tt.want {
+			t.Errorf("Delay(%d) = %s, want %s", tt.numDelivered, got, tt.want)
+		}
+	}
+
+	if got := (ScheduleBackoff{}).Delay(3); got != defaultNackDelay {
+		t.Errorf("empty schedule Delay = %s, want %s", got, defaultNackDelay)
+	}
+}
+
+func TestNackDelay(t *testing.T) {
+	nc := &NatsClientJetStream{}
+	if got := nc.nackDelay(5); got != defaultNackDelay {
+		t.Errorf("without policy nackDelay = %s, want %s", got, defaultNackDelay)
+	}
+
+	WithBackoff(FixedBackoff(3 * time.Second)).Apply(&nc.opts)
+	if got := nc.nackDelay(5); got != 3*time.Second {
+		t.Errorf("fixed nackDelay = %s, want 3s", got)
+	}
+
+	WithBackoff(ExponentialBackoff{Initial: time.Second, Max: 4 * time.Second}).Apply(&nc.opts)
+	if got := nc.nackDelay(10); got != 4*time.Second {
+		t.Errorf("exponential nackDelay = %s, want 4s", got)
+	}
+}
@@ -0,0 +1,204 @@
+package natsClient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultBatchMaxMessages = 100
+	defaultBatchMaxWait     = 5 * time.Second
+	batchFetchErrorDelay    = 1 * time.Second
+)
+
+// BatchConfig батч собирается, пока в нем меньше MaxMessages сообщений, но не дольше MaxWait
+type BatchConfig struct {
+	MaxMessages int
+	MaxWait     time.Duration
+}
+
+func (cfg BatchConfig) withDefaults() BatchConfig {
+	if cfg.MaxMessages < 1 {
+		cfg.MaxMessages = defaultBatchMaxMessages
+	}
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = defaultBatchMaxWait
+	}
+	return cfg
+}
+
+/*
+SubscribeBatch
+Запускает pull консумер, который передает сообщения хендлеру батчами.
+Сообщения подтверждаются по результату каждого элемента (mqClient.BatchError),
+ошибки обрабатываются так же, как в SubscribeV2 (DLQ, Terminate, RetryAfter, backoff).
+Если консумер не удалось запустить, он переподключается в фоне (см. Status)
+*/
+func (nc *NatsClientJetStream) SubscribeBatch(
+	ctx context.Context,
+	streamName string,
+	consumerName string,
+	cfg BatchConfig,
+	handler mqClient.MqBatchHandler,
+) error {
+	log := logger.From(ctx)
+
+	subscribe := func() error {
+		consumer, err := nc.getConsumer(ctx, streamName, consumerName)
+		if err != nil {
+			return err
+		}
+		nc.consumeBatch(ctx, consumer, streamName, consumerName, cfg.withDefaults(), handler)
+		return nil
+	}
+
+	if err := subscribe(); err != nil {
+		log.Warn().Err(err).Msgf("failed to init batch consumer %s on stream %s", consumerName, streamName)
+		nc.superviseResubscribe(ctx, streamName, consumerName, subscribe, err)
+		return nil
+	}
+	log.Info().Msgf("successfully init batch consumer %s on stream %s", consumerName, streamName)
+	return nil
+}
+
+type batchFetchLoop struct {
+	stopOnce sync.Once
+	stop     chan struct{}
+	closed   chan struct{}
+}
+
+func (l *batchFetchLoop) Stop() {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+}
+
+func (l *batchFetchLoop) Closed() <-chan struct{} {
+	return l.closed
+}
+
+func (nc *NatsClientJetStream) consumeBatch(
+	ctx context.Context,
+	consumer jetstream.Consumer,
+	streamName string,
+	consumerName string,
+	cfg BatchConfig,
+	handler mqClient.MqBatchHandler,
+) {
+	log := logger.From(ctx).With().Fields(map[string]interface{}{
+		"layer":     "handlers",
+		"layerType": "mqBatch",
+		"stream":    streamName,
+		"consumer":  consumerName,
+	}).Logger()
+
+	deadLetterPolicy, withDeadLetter := nc.deadLetterPolicy(streamName, consumerName)
+
+	loop := &batchFetchLoop{
+		stop:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(loop.closed)
+
+		var fetchFailed bool
+		for {
+			select {
+			case <-loop.stop:
+				return
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			msgs, err := fetchBatch(consumer, cfg)
+			if err != nil {
+				log.Warn().Err(err).Msgf("failed to fetch batch, got %d messages", len(msgs))
+				nc.setConsumerState(streamName, consumerName, ConsumerStateFailed, err)
+				fetchFailed = true
+
+				if len(msgs) == 0 {
+					select {
+					case <-loop.stop:
+						return
+					case <-ctx.Done():
+						return
+					case <-time.After(batchFetchErrorDelay):
+					}
+					continue
+				}
+			} else if fetchFailed {
+				nc.setConsumerState(streamName, consumerName, ConsumerStateActive, nil)
+				fetchFailed = false
+			}
+
+			if len(msgs) == 0 {
+				continue
+			}
+
+			payloads := make([][]byte, len(msgs))
+			for i, msg := range msgs {
+				payloads[i] = msg.Data()
+			}
+
+			batchErr := callBatchHandler(ctx, handler, payloads)
+			for i, msg := range msgs {
+				nc.finishJsMsg(
+					mqClient.ContextWithMeta(ctx, jsMsgMeta(msg)),
+					log,
+					msg,
+					mqClient.BatchItemError(batchErr, i),
+					deadLetterPolicy,
+					withDeadLetter,
+				)
+			}
+		}
+	}()
+
+	nc.mx.Lock()
+	nc.consumers = append(nc.consumers, &jsConsumer{
+		stream:     streamName,
+		name:       consumerName,
+		consumer:   consumer,
+		consumeCtx: loop,
+	})
+	nc.mx.Unlock()
+
+	nc.setConsumerState(streamName, consumerName, ConsumerStateActive, nil)
+}
+
+func fetchBatch(consumer jetstream.Consumer, cfg BatchConfig) ([]jetstream.Msg, error) {
+	batch, err := consumer.Fetch(cfg.MaxMessages, jetstream.FetchMaxWait(cfg.MaxWait))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	msgs := make([]jetstream.Msg, 0, cfg.MaxMessages)
+	for msg := range batch.Messages() {
+		msgs = append(msgs, msg)
+	}
+
+	if err := batch.Error(); err != nil && !errors.Is(err, nats.ErrTimeout) {
+		return msgs, errors.WithStack(err)
+	}
+	return msgs, nil
+}
+
+func callBatchHandler(ctx context.Context, handler mqClient.MqBatchHandler, payloads [][]byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log := logger.From(ctx)
+			log.Error().Msgf("mq batch handler panic: %v", r)
+			err = errors.Errorf("batch handler panic: %v", r)
+		}
+	}()
+	return handler(ctx, payloads)
+}
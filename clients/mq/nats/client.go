@@ -2,7 +2,6 @@ package natsClient
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"reflect"
 	"runtime"
@@ -11,11 +10,13 @@ import (
 	"time"
 
 	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	mqMiddleware "github.com/balobas/sport_city_common/clients/mq/middleware"
 	"github.com/balobas/sport_city_common/logger"
 	"github.com/balobas/sport_city_common/tracer"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -27,41 +28,96 @@ type Config interface {
 }
 
 type NatsClientPubSub struct {
+	cfg  Config
 	conn *nats.Conn
+
+	opts NatsClientPubSubOpts
+}
+
+type NatsClientPubSubOption interface {
+	Apply(*NatsClientPubSubOpts)
+}
+
+type NatsClientPubSubOpts struct {
+	withTrace   bool
+	middlewares []mqClient.MqMiddleware
+}
+
+type natsPubSubOptionWithTrace bool
+
+func (nt natsPubSubOptionWithTrace) Apply(opt *NatsClientPubSubOpts) {
+	opt.withTrace = bool(nt)
+}
+
+// WithPubSubTrace как WithTrace у JetStream: трейс передается в заголовках при публикации и продолжается в подписках
+func WithPubSubTrace() NatsClientPubSubOption {
+	return natsPubSubOptionWithTrace(true)
 }
 
-func NewPubSub(cfg Config) (mqClient.MqClient, error) {
+type natsPubSubOptionWithMiddlewares []mqClient.MqMiddleware
+
+func (nm natsPubSubOptionWithMiddlewares) Apply(opt *NatsClientPubSubOpts) {
+	opt.middlewares = append(opt.middlewares, nm...)
+}
+
+// WithPubSubMiddlewares middlewares для всех подписок клиента, вызываются после Recovery
+func WithPubSubMiddlewares(middlewares ...mqClient.MqMiddleware) NatsClientPubSubOption {
+	return natsPubSubOptionWithMiddlewares(middlewares)
+}
+
+func NewPubSub(cfg Config, opts ...NatsClientPubSubOption) (mqClient.MqClient, error) {
 	log := logger.Logger()
 
-	conn, err := nats.Connect(
-		cfg.NatsUrl(), nats.Name(cfg.NatsClientName()),
-		nats.ReconnectHandler(func(c *nats.Conn) {
-			log.Info().Msg("nats has been recconected")
-		}),
-		nats.ErrorHandler(func(c *nats.Conn, s *nats.Subscription, err error) {
-			log.Info().Msgf("nats error handler: error occured: sub %s : %v", s.Subject, err)
-		}),
-		nats.DisconnectHandler(func(c *nats.Conn) {
-			log.Info().Msg("nats disconnect")
-		}),
-		nats.ClosedHandler(func(c *nats.Conn) {
-			log.Info().Msg("nats closed")
-		}),
-		nats.ConnectHandler(func(c *nats.Conn) {
-			log.Info().Msgf("nats successfully connected to %s", c.ConnectedAddr())
-		}),
-		nats.RetryOnFailedConnect(true),
-	)
+	conn, err := connect(cfg, log, connHooks{})
 	if err != nil {
-		log.Debug().Err(err).Msgf("failed to connect to nats (url: %s)", cfg.NatsUrl())
 		return nil, err
 	}
 
-	return &NatsClientPubSub{conn: conn}, nil
+	nc := &NatsClientPubSub{cfg: cfg, conn: conn}
+	for _, opt := range opts {
+		opt.Apply(&nc.opts)
+	}
+	return nc, nil
 }
 
 func (nc *NatsClientPubSub) Publish(ctx context.Context, subj string, data []byte) error {
-	return nc.conn.Publish(subj, data)
+	_, err := nc.PublishMsg(ctx, mqClient.PublishMsg{
+		Subject: subj,
+		Data:    data,
+	})
+	return err
+}
+
+func (nc *NatsClientPubSub) PublishMsg(ctx context.Context, msg mqClient.PublishMsg) (mqClient.PublishAck, error) {
+	// заголовки копируются: msg.Headers может переиспользоваться вызывающим
+	natsMsg := &nats.Msg{
+		Subject: msg.Subject,
+		Data:    msg.Data,
+		Header:  make(nats.Header, len(msg.Headers)+1),
+	}
+	for k, v := range msg.Headers {
+		natsMsg.Header[k] = v
+	}
+	if len(msg.MsgId) != 0 {
+		natsMsg.Header.Set(nats.MsgIdHdr, msg.MsgId)
+	}
+	if nc.opts.withTrace {
+		injectTraceIntoHeaders(ctx, natsMsg.Header)
+	}
+
+	if err := nc.conn.PublishMsg(natsMsg); err != nil {
+		return mqClient.PublishAck{}, errors.WithStack(err)
+	}
+	return mqClient.PublishAck{}, nil
+}
+
+// PublishBatch core nats не подтверждает доставку, сообщения публикуются по одному
+func (nc *NatsClientPubSub) PublishBatch(ctx context.Context, msgs []mqClient.PublishMsg) []mqClient.PublishResult {
+	results := make([]mqClient.PublishResult, len(msgs))
+	for i, msg := range msgs {
+		results[i].Ack, results[i].Err = nc.PublishMsg(ctx, msg)
+	}
+	return results
 }
 
 func (nc *NatsClientPubSub) Subscribe(ctx context.Context, handlers map[string]map[string]mqClient.MqMsgHandler) error {
@@ -70,7 +126,7 @@ func (nc *NatsClientPubSub) Subscribe(ctx context.Context, handlers map[string]m
 	h := handlers[mqClient.PubsubKey]
 	for subject, handler := range h {
 
-		_, err := nc.conn.Subscribe(subject, convertToNatsMsgHandler(ctx, handler))
+		_, err := nc.conn.Subscribe(subject, convertToNatsMsgHandler(ctx, handler, nc.opts))
 		if err != nil {
 			log.Debug().Msgf("failed to subscribe on subject %s", subject)
 			return errors.WithStack(err)
@@ -89,11 +145,17 @@ func (nc *NatsClientPubSub) Close(ctx context.Context) error {
 	return nil
 }
 
-func convertToNatsMsgHandler(ctx context.Context, handler mqClient.MqMsgHandler) nats.MsgHandler {
+func convertToNatsMsgHandler(ctx context.Context, handler mqClient.MqMsgHandler, opts NatsClientPubSubOpts) nats.MsgHandler {
+	middlewares := []mqClient.MqMiddleware{mqMiddleware.Recovery()}
+	if opts.withTrace {
+		middlewares = append(middlewares, mqMiddleware.Tracing(""))
+	}
+	handler = mqClient.Chain(handler, append(middlewares, opts.middlewares...)...)
+
 	return func(msg *nats.Msg) {
 		log := logger.Logger()
 
-		if err := handler(ctx, msg.Data); err != nil {
+		if err := handler(mqClient.ContextWithMeta(ctx, natsMsgMeta(msg)), msg.Data); err != nil {
 			log.Error().Err(err).Msgf("failed to handle message %s", msg.Data)
 			nackWithLog(msg)
 			return
@@ -113,15 +175,22 @@ func nackWithLog(msg *nats.Msg) {
 }
 
 type NatsClientJetStream struct {
-	cfg           Config
-	conn          *nats.Conn
-	js            jetstream.JetStream
-	consumersCtxs []jetstream.ConsumeContext
+	cfg  Config
+	conn *nats.Conn
+	js   jetstream.JetStream
+
+	mx        sync.Mutex
+	consumers []*jsConsumer
+	statuses  map[consumerKey]*consumerStatus
 
 	opts NatsClientJsOpts
 
-	wg        *sync.WaitGroup
-	connected chan struct{}
+	wg            *sync.WaitGroup
+	resubscribing map[consumerKey]struct{}
+	reconnected   *signal
+	stopOnce      *sync.Once
+	stop          chan struct{}
+	closed        chan struct{}
 }
 
 type NatsClientJetStreamOption interface {
@@ -131,6 +200,25 @@ type NatsClientJetStreamOption interface {
 type NatsClientJsOpts struct {
 	withoutNackOnErrors bool
 	withTrace           bool
+
+	deadLetterPolicies map[consumerKey]DeadLetterPolicy
+	deadLetterHook     DeadLetterHook
+
+	backoff BackoffPolicy
+
+	streamSpecs      []StreamSpec
+	kvBucketSpecs    []KVBucketSpec
+	objectStoreSpecs []ObjectStoreSpec
+
+	maxInFlight        map[consumerKey]int
+	defaultMaxInFlight int
+
+	resubscribeBackoff BackoffPolicy
+
+	middlewares []mqClient.MqMiddleware
+
+	publishAsyncMaxPending int
+	publishAsyncStallWait  time.Duration
 }
 
 type natsJsOptionWithoutNackOnErrors bool
@@ -155,45 +243,38 @@ func WithTrace() NatsClientJetStreamOption {
 	return &n
 }
 
+type natsJsOptionWithMiddlewares []mqClient.MqMiddleware
+
+func (nm natsJsOptionWithMiddlewares) Apply(opt *NatsClientJsOpts) {
+	opt.middlewares = append(opt.middlewares, nm...)
+}
+
+// WithMiddlewares middlewares для всех консумеров клиента, вызываются после Recovery и трейсинга (WithTrace)
+func WithMiddlewares(middlewares ...mqClient.MqMiddleware) NatsClientJetStreamOption {
+	return natsJsOptionWithMiddlewares(middlewares)
+}
+
 func NewJs(ctx context.Context, cfg Config, opts ...NatsClientJetStreamOption) (mqClient.MqClient, error) {
 	log := logger.From(ctx)
-	connectedChan := make(chan struct{})
-
-	conn, err := nats.Connect(
-		cfg.NatsUrl(), nats.Name(cfg.NatsClientName()),
-		nats.ReconnectHandler(func(c *nats.Conn) {
-			select {
-			case connectedChan <- struct{}{}:
-			default:
-			}
-			log.Info().Msg("nats has been recconected")
-		}),
-		nats.ErrorHandler(func(c *nats.Conn, s *nats.Subscription, err error) {
-			log.Info().Msgf("nats error handler: error occured: sub %s", s.Subject)
-		}),
-		nats.DisconnectHandler(func(c *nats.Conn) {
-			log.Info().Msg("nats disconnect")
-		}),
-		nats.ClosedHandler(func(c *nats.Conn) {
-			log.Info().Msg("nats closed")
-		}),
-		nats.MaxReconnects(-1),
-		nats.ConnectHandler(func(c *nats.Conn) {
-
-			select {
-			case connectedChan <- struct{}{}:
-			default:
-			}
-			log.Info().Msgf("nats successfully connected to %s", c.ConnectedAddr())
-		}),
-		nats.RetryOnFailedConnect(true),
-	)
+	reconnected := newSignal()
+	closedChan := make(chan struct{})
+
+	conn, err := connect(cfg, log, connHooks{
+		onConnect: reconnected.Notify,
+		onClosed: func() {
+			close(closedChan)
+		},
+	}, nats.MaxReconnects(-1))
 	if err != nil {
-		log.Debug().Err(err).Msgf("failed to connect to nats (url: %s)", cfg.NatsUrl())
 		return nil, err
 	}
 
-	js, err := jetstream.New(conn)
+	var jsOpts NatsClientJsOpts
+	for _, opt := range opts {
+		opt.Apply(&jsOpts)
+	}
+
+	js, err := jetstream.New(conn, jsOpts.jetStreamOpts()...)
 	if err != nil {
 		conn.Close()
 		log.Debug().Err(err).Msg("failed to init nats jet stream")
@@ -201,164 +282,153 @@ func NewJs(ctx context.Context, cfg Config, opts ...NatsClientJetStreamOption) (
 	}
 
 	nc := &NatsClientJetStream{
-		cfg:       cfg,
-		conn:      conn,
-		js:        js,
-		wg:        &sync.WaitGroup{},
-		connected: connectedChan,
+		cfg:         cfg,
+		conn:        conn,
+		js:          js,
+		opts:        jsOpts,
+		wg:          &sync.WaitGroup{},
+		reconnected: reconnected,
+		stopOnce:    &sync.Once{},
+		stop:        make(chan struct{}),
+		closed:      closedChan,
 	}
 
-	for _, opt := range opts {
-		opt.Apply(&nc.opts)
+	if len(nc.opts.streamSpecs) != 0 {
+		if err := nc.Provision(ctx, nc.opts.streamSpecs...); err != nil {
+			conn.Close()
+			log.Debug().Err(err).Msg("failed to provision nats js streams")
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if len(nc.opts.kvBucketSpecs) != 0 {
+		if err := nc.ProvisionKV(ctx, nc.opts.kvBucketSpecs...); err != nil {
+			conn.Close()
+			log.Debug().Err(err).Msg("failed to provision nats kv buckets")
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if len(nc.opts.objectStoreSpecs) != 0 {
+		if err := nc.ProvisionObjectStores(ctx, nc.opts.objectStoreSpecs...); err != nil {
+			conn.Close()
+			log.Debug().Err(err).Msg("failed to provision nats object stores")
+			return nil, errors.WithStack(err)
+		}
 	}
 
 	return nc, nil
 }
 
 func (nc *NatsClientJetStream) Publish(ctx context.Context, subj string, data []byte) error {
+	_, err := nc.PublishMsg(ctx, mqClient.PublishMsg{
+		Subject: subj,
+		Data:    data,
+	})
+	return err
+}
+
+/*
+PublishMsg
+Если задан MsgId, он передается в Nats-Msg-Id и сервер отбрасывает повторы
+в пределах duplicate window стрима (ack.Duplicate == true)
+*/
+func (nc *NatsClientJetStream) PublishMsg(ctx context.Context, pubMsg mqClient.PublishMsg) (mqClient.PublishAck, error) {
 	log := logger.From(ctx).With().Fields(map[string]interface{}{
 		"layer":     "mqPublisher",
 		"component": "NatsClientJetStream",
-		"method":    "Publish",
+		"method":    "PublishMsg",
 	}).Logger()
 	log.Debug().Fields(map[string]interface{}{
-		"subject": subj,
-		"data":    string(data),
+		"subject": pubMsg.Subject,
+		"msgId":   pubMsg.MsgId,
+		"data":    string(pubMsg.Data),
 	}).Send()
 
+	msg, pubOpts := newJsPublishMsg(pubMsg)
+
 	var span trace.Span = trace.SpanFromContext(ctx)
 	if nc.opts.withTrace {
-		var msgTraceInfo msgWithTraceId
-		if err := json.Unmarshal(data, &msgTraceInfo); err != nil {
-			log.Warn().Str("error", err.Error()).Msg("failed to unmarshal traceID from message")
-		} else {
-			traceId, err := trace.TraceIDFromHex(msgTraceInfo.TraceId)
-			if err != nil {
-				log.Error().Err(err).Msg("invalid trace id")
-			} else {
-				spanContext := trace.NewSpanContext(trace.SpanContextConfig{
-					TraceID: traceId,
-				})
-				ctx = trace.ContextWithSpanContext(ctx, spanContext)
-			}
+		if !span.SpanContext().IsValid() {
+			ctx = ctxWithTraceIdFromPayload(ctx, log, pubMsg.Data)
 		}
-		ctx, span = tracer.FromCtx(ctx).Start(ctx, "NatsClientJetStream.Publish")
+		ctx, span = tracer.FromCtx(ctx).Start(ctx, "NatsClientJetStream.Publish", trace.WithSpanKind(trace.SpanKindProducer))
 		defer span.End()
+
+		injectTraceIntoHeaders(ctx, msg.Header)
 	}
 
-	ack, err := nc.js.Publish(ctx, subj, data)
+	ack, err := nc.js.PublishMsg(ctx, msg, pubOpts...)
 	if err != nil {
 		span.RecordError(err, trace.WithAttributes(
 			attribute.String("message", "failed to publish message"),
 		))
 		log.Debug().Msg("failed to publish message")
-		return errors.WithStack(err)
+		return mqClient.PublishAck{}, errors.WithStack(err)
 	}
 	log.Info().Msgf("ack info: stream %s, domain %s, duplicate %t, sequence %d", ack.Stream, ack.Domain, ack.Duplicate, ack.Sequence)
-	return nil
+
+	return toPublishAck(ack), nil
+}
+
+func newJsPublishMsg(pubMsg mqClient.PublishMsg) (*nats.Msg, []jetstream.PublishOpt) {
+	msg := &nats.Msg{
+		Subject: pubMsg.Subject,
+		Data:    pubMsg.Data,
+		Header:  nats.Header{},
+	}
+	for k, v := range pubMsg.Headers {
+		msg.Header[k] = v
+	}
+
+	var pubOpts []jetstream.PublishOpt
+	if len(pubMsg.MsgId) != 0 {
+		pubOpts = append(pubOpts, jetstream.WithMsgID(pubMsg.MsgId))
+	}
+	return msg, pubOpts
+}
+
+func toPublishAck(ack *jetstream.PubAck) mqClient.PublishAck {
+	return mqClient.PublishAck{
+		Stream:    ack.Stream,
+		Sequence:  ack.Sequence,
+		Duplicate: ack.Duplicate,
+	}
 }
 
 // Deprecated
 func (nc *NatsClientJetStream) Subscribe(ctx context.Context, handlersStreams map[string]map[string]mqClient.MqMsgHandler) (subErr error) {
 	log := logger.From(ctx)
-	failedStreams := map[string]map[string]mqClient.MqMsgHandler{}
-
-	defer func() {
-		if subErr == nil {
-			nc.resubscribeOnFailedStreams(ctx, failedStreams)
-		}
-	}()
 
 	for streamName, handlers := range handlersStreams {
-
-		stream, err := nc.js.Stream(ctx, streamName)
-		if err != nil {
-			log.Warn().Err(err).Msgf("failed to get stream %s", streamName)
-			failedStreams[streamName] = handlers
-			continue
-		}
-
 		for subject, handler := range handlers {
 
-			subjectParts := strings.Split(subject, ".")
-			if len(subjectParts) != 2 {
-				log.Debug().Err(err).Msgf("invalid message subject %s", subject)
+			consumerName, ok := nc.subjectConsumerName(subject)
+			if !ok {
+				log.Debug().Msgf("invalid message subject %s", subject)
 				return errors.Errorf("invalid message subject %s", subject)
 			}
 
-			consumerName := fmt.Sprintf("%s_%s_consumer", nc.cfg.ServiceName(), strings.Split(subject, ".")[1])
-			consumer, err := stream.Consumer(ctx, consumerName)
-			if err != nil {
-				log.Warn().Err(err).Msgf("failed to get consumer %s on stream %s subject %s", consumerName, streamName, subject)
-				addSubjectToFailedStreams(streamName, subject, handler, failedStreams)
-				continue
-			}
-
-			consumerCtx, err := consumer.Consume(nc.convertToNatsJsMsgHandler(ctx, handler))
-			if err != nil {
+			if err := nc.subscribeConsumer(ctx, streamName, consumerName, handler); err != nil {
 				log.Warn().Err(err).Msgf("failed to init consumer %s on stream %s subject %s", consumerName, streamName, subject)
-				addSubjectToFailedStreams(streamName, subject, handler, failedStreams)
+				nc.superviseResubscribe(ctx, streamName, consumerName, func() error {
+					return nc.subscribeConsumer(ctx, streamName, consumerName, handler)
+				}, err)
 				continue
 			}
 			log.Info().Msgf("successfully init consumer %s on stream %s subject %s", consumerName, streamName, subject)
-
-			nc.consumersCtxs = append(nc.consumersCtxs, consumerCtx)
 		}
 	}
 
 	return nil
 }
 
-func addSubjectToFailedStreams(
-	streamName string,
-	subject string,
-	handler mqClient.MqMsgHandler,
-	failedStreams map[string]map[string]mqClient.MqMsgHandler,
-) {
-	failedStream, ok := failedStreams[streamName]
-	if !ok {
-		failedStreams[streamName] = map[string]mqClient.MqMsgHandler{
-			subject: handler,
-		}
-	} else {
-		failedStream[subject] = handler
+func (nc *NatsClientJetStream) subjectConsumerName(subject string) (string, bool) {
+	subjectParts := strings.Split(subject, ".")
+	if len(subjectParts) != 2 {
+		return "", false
 	}
-}
-
-func (nc *NatsClientJetStream) resubscribeOnFailedStreams(ctx context.Context, failedStreams map[string]map[string]mqClient.MqMsgHandler) {
-	if len(failedStreams) == 0 {
-		return
-	}
-	log := logger.From(ctx)
-
-	nc.wg.Add(1)
-	go func() {
-		defer nc.wg.Done()
-
-		select {
-		case <-ctx.Done():
-			log.Info().Msg("stop attempts to init failed consumers, ctx done")
-			return
-		case <-nc.connected:
-			select {
-			case <-ctx.Done():
-				log.Info().Msg("stop attempts to init failed consumers, ctx done")
-				return
-			default:
-			}
-
-			nc.Subscribe(ctx, failedStreams)
-		case <-time.After(1 * time.Minute):
-			select {
-			case <-ctx.Done():
-				log.Info().Msg("stop attempts to init failed consumers, ctx done")
-				return
-			default:
-			}
-
-			nc.Subscribe(ctx, failedStreams)
-		}
-	}()
+	return fmt.Sprintf("%s_%s_consumer", nc.cfg.ServiceName(), subjectParts[1]), true
 }
 
 // v2
@@ -372,122 +442,68 @@ SubscribeV2
 			"cunsumerName": handler,
 		}
 	}
+Консумеры, которые не удалось запустить, переподключаются в фоне (см. Status)
 */
 func (nc *NatsClientJetStream) SubscribeV2(ctx context.Context, streamsConsumers map[string]map[string]mqClient.MqMsgHandler) (subErr error) {
 	log := logger.From(ctx)
-	failedStreams := map[string]map[string]mqClient.MqMsgHandler{}
-
-	defer func() {
-		if subErr == nil {
-			nc.resubscribeOnFailedStreamsV2(ctx, failedStreams)
-		}
-	}()
 
 	for streamName, consumers := range streamsConsumers {
-
-		stream, err := nc.js.Stream(ctx, streamName)
-		if err != nil {
-			log.Warn().Err(err).Msgf("failed to get stream %s", streamName)
-			failedStreams[streamName] = consumers
-			continue
-		}
-
 		for consumerName, handler := range consumers {
-			consumer, err := stream.Consumer(ctx, consumerName)
-			if err != nil {
-				log.Warn().Err(err).Msgf("failed to get consumer %s on stream %s", consumerName, streamName)
-				addConsumerWithHandlerIntoFailedStreams(failedStreams, streamName, consumerName, handler)
-				continue
-			}
-
-			consumerCtx, err := consumer.Consume(nc.convertToNatsJsMsgHandler(ctx, handler))
-			if err != nil {
+			if err := nc.subscribeConsumer(ctx, streamName, consumerName, handler); err != nil {
 				log.Warn().Err(err).Msgf("failed to init consumer %s on stream %s", consumerName, streamName)
-				addConsumerWithHandlerIntoFailedStreams(failedStreams, streamName, consumerName, handler)
+				nc.superviseResubscribe(ctx, streamName, consumerName, func() error {
+					return nc.subscribeConsumer(ctx, streamName, consumerName, handler)
+				}, err)
 				continue
 			}
 			log.Info().Msgf("successfully init consumer %s on stream %s", consumerName, streamName)
-
-			nc.consumersCtxs = append(nc.consumersCtxs, consumerCtx)
 		}
 	}
 
 	return nil
 }
 
-func addConsumerWithHandlerIntoFailedStreams(
-	failedStreams map[string]map[string]mqClient.MqMsgHandler,
-	streamName string,
-	consumerName string,
-	handler mqClient.MqMsgHandler,
-) {
-	streamConsumers, ok := failedStreams[streamName]
-	if !ok {
-		failedStreams[streamName] = map[string]mqClient.MqMsgHandler{
-			consumerName: handler,
-		}
-	} else {
-		streamConsumers[consumerName] = handler
-	}
-}
-
-func (nc *NatsClientJetStream) resubscribeOnFailedStreamsV2(ctx context.Context, failedStreams map[string]map[string]mqClient.MqMsgHandler) {
-	if len(failedStreams) == 0 {
-		return
-	}
-	log := logger.From(ctx)
-
-	nc.wg.Add(1)
-	go func() {
-		defer nc.wg.Done()
-
-		select {
-		case <-ctx.Done():
-			log.Info().Msg("stop attempts to init failed consumers, ctx done")
-			return
-		case <-nc.connected:
-			select {
-			case <-ctx.Done():
-				log.Info().Msg("stop attempts to init failed consumers, ctx done")
-				return
-			default:
-			}
-
-			nc.SubscribeV2(ctx, failedStreams)
-		case <-time.After(1 * time.Minute):
-			select {
-			case <-ctx.Done():
-				log.Info().Msg("stop attempts to init failed consumers, ctx done")
-				return
-			default:
-			}
-
-			nc.SubscribeV2(ctx, failedStreams)
-		}
-	}()
-}
-
 // v2 end
 
+/*
+Close
+Останавливает консумеры и ждет завершения обрабатываемых сообщений до ctx.Done,
+после чего дренит соединение
+*/
 func (nc *NatsClientJetStream) Close(ctx context.Context) error {
 	log := logger.From(ctx)
 
-	for _, consumerCtx := range nc.consumersCtxs {
-		consumerCtx.Stop()
+	nc.stopOnce.Do(func() {
+		close(nc.stop)
+	})
+	if err := nc.stopConsumers(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to gracefully stop consumers")
 	}
-	nc.conn.Close()
+
+	if err := nc.conn.Drain(); err != nil {
+		log.Warn().Err(err).Msg("failed to drain nats connection, closing")
+		nc.conn.Close()
+	}
+
+	select {
+	case <-nc.closed:
+	case <-ctx.Done():
+		log.Warn().Err(ctx.Err()).Msg("nats connection drain not finished, closing")
+		nc.conn.Close()
+	}
+
 	nc.wg.Wait()
-	close(nc.connected)
 
 	log.Info().Msg("nats js client closed successfully")
 	return nil
 }
 
-type msgWithTraceId struct {
-	TraceId string `json:"traceId"`
-}
-
-func (nc *NatsClientJetStream) convertToNatsJsMsgHandler(ctx context.Context, handler mqClient.MqMsgHandler) jetstream.MessageHandler {
+func (nc *NatsClientJetStream) convertToNatsJsMsgHandler(
+	ctx context.Context,
+	streamName string,
+	consumerName string,
+	handler mqClient.MqMsgHandler,
+) jetstream.MessageHandler {
 	var (
 		parentStructName string
 		fnName           string
@@ -504,6 +520,14 @@ func (nc *NatsClientJetStream) convertToNatsJsMsgHandler(ctx context.Context, ha
 		fnName = strings.Split(fnNameParts[len(fnNameParts)-1], "-")[0]
 	}
 
+	deadLetterPolicy, withDeadLetter := nc.deadLetterPolicy(streamName, consumerName)
+
+	middlewares := []mqClient.MqMiddleware{mqMiddleware.Recovery()}
+	if nc.opts.withTrace {
+		middlewares = append(middlewares, mqMiddleware.Tracing(fmt.Sprintf("%s.%s", parentStructName, fnName)))
+	}
+	handler = mqClient.Chain(handler, append(middlewares, nc.opts.middlewares...)...)
+
 	return func(msg jetstream.Msg) {
 		log := logger.From(ctx).With().Fields(map[string]interface{}{
 			"layer":     "handlers",
@@ -515,52 +539,66 @@ func (nc *NatsClientJetStream) convertToNatsJsMsgHandler(ctx context.Context, ha
 			"msg": string(msg.Data()),
 		}).Send()
 
-		var span trace.Span = trace.SpanFromContext(ctx)
-		if nc.opts.withTrace {
-			var msgTraceInfo msgWithTraceId
-			if err := json.Unmarshal(msg.Data(), &msgTraceInfo); err != nil {
-				log.Warn().Str("error", err.Error()).Msg("failed to unmarshal traceID from message")
-			} else {
-				traceId, err := trace.TraceIDFromHex(msgTraceInfo.TraceId)
-				if err != nil {
-					log.Error().Err(err).Msg("invalid trace id")
-				} else {
-					spanContext := trace.NewSpanContext(trace.SpanContextConfig{
-						TraceID: traceId,
-					})
-					ctx = trace.ContextWithSpanContext(ctx, spanContext)
-				}
-			}
-			ctx, span = tracer.FromCtx(ctx).Start(ctx, fmt.Sprintf("%s.%s", parentStructName, fnName))
-			defer span.End()
-		}
+		msgCtx := mqClient.ContextWithMeta(ctx, jsMsgMeta(msg))
 
-		if err := handler(ctx, msg.Data()); err != nil {
-			span.RecordError(err, trace.WithAttributes(
-				attribute.String("message", "failed to handle message"),
-			))
-			log.Error().Err(err).Msgf("failed to handle message %s", msg.Data())
-			if nc.opts.withoutNackOnErrors {
-				return
-			}
+		nc.finishJsMsg(msgCtx, log, msg, handler(msgCtx, msg.Data()), deadLetterPolicy, withDeadLetter)
+	}
+}
 
-			nackJsMsgWithLog(ctx, msg) // добавить в трейс ошибку
+// finishJsMsg подтверждает сообщение или, если обработка завершилась ошибкой, отправляет его в DLQ, терминирует или нэкает
+func (nc *NatsClientJetStream) finishJsMsg(
+	ctx context.Context,
+	log zerolog.Logger,
+	msg jetstream.Msg,
+	handleErr error,
+	deadLetterPolicy DeadLetterPolicy,
+	withDeadLetter bool,
+) {
+	if handleErr != nil {
+		log.Error().Err(handleErr).Msgf("failed to handle message %s", msg.Data())
+		if withDeadLetter && nc.moveToDeadLetterIfExhausted(ctx, msg, deadLetterPolicy, handleErr) {
+			return
+		}
+		if mqClient.IsTerminateError(handleErr) {
+			termJsMsgWithLog(ctx, msg)
 			return
 		}
 
-		if err := msg.Ack(); err != nil {
-			span.RecordError(err, trace.WithAttributes(
-				attribute.String("message", "failed to ack message"),
-			))
-			log.Error().Err(err).Msgf("failed to ack message %s", msg.Data())
+		delay, isDelayRequested := mqClient.RetryDelayFromError(handleErr)
+		if nc.opts.withoutNackOnErrors && !isDelayRequested {
+			return
 		}
+		if !isDelayRequested {
+			delay = nc.nackDelay(numDelivered(msg))
+		}
+
+		nackJsMsgWithLog(ctx, msg, delay)
+		return
+	}
+
+	if err := msg.Ack(); err != nil {
+		log.Error().Err(err).Msgf("failed to ack message %s", msg.Data())
 	}
 }
 
-func nackJsMsgWithLog(ctx context.Context, msg jetstream.Msg) {
+func nackJsMsgWithLog(ctx context.Context, msg jetstream.Msg, delay time.Duration) {
 	log := logger.From(ctx)
-	// default delay, TODO: refactor
-	if err := msg.NakWithDelay(1 * time.Second); err != nil {
+	if err := msg.NakWithDelay(delay); err != nil {
 		log.Error().Err(err).Msgf("failed to nack msg %s", msg.Data())
 	}
 }
+
+func termJsMsgWithLog(ctx context.Context, msg jetstream.Msg) {
+	log := logger.From(ctx)
+	if err := msg.TermWithReason("terminated by handler"); err != nil {
+		log.Error().Err(err).Msgf("failed to term msg %s", msg.Data())
+	}
+}
+
+func numDelivered(msg jetstream.Msg) uint64 {
+	meta, err := msg.Metadata()
+	if err != nil {
+		return 1
+	}
+	return meta.NumDelivered
+}
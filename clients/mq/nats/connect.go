@@ -0,0 +1,136 @@
+package natsClient
+
+import (
+	commonConfig "github.com/balobas/sport_city_common/config"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+/*
+SecurityConfig
+Опционально реализуется Config. Пустые значения не используются:
+  - NatsTLSCAFile - CA для проверки сертификата сервера
+  - NatsTLSCertFile, NatsTLSKeyFile - клиентский сертификат (mTLS)
+  - NatsCredsFile - creds файл пользователя (JWT + NKey seed)
+  - NatsNKeySeedFile - файл с NKey seed пользователя
+  - NatsUser, NatsPassword - пароль
+  - NatsToken - токен
+
+commonConfig.NatsSecurityConfig реализует интерфейс из env.
+Если заданы переменные окружения NATS_TLS_*, NATS_CREDS_FILE, NATS_NKEY_SEED_FILE,
+NATS_USER, NATS_PASSWORD или NATS_TOKEN, а Config не реализует SecurityConfig,
+клиент не создается, чтобы не подключиться молча без TLS и авторизации
+*/
+type SecurityConfig interface {
+	NatsTLSCAFile() string
+	NatsTLSCertFile() string
+	NatsTLSKeyFile() string
+	NatsCredsFile() string
+	NatsNKeySeedFile() string
+	NatsUser() string
+	NatsPassword() string
+	NatsToken() string
+}
+
+func securityOptions(cfg Config) ([]nats.Option, error) {
+	secCfg, ok := cfg.(SecurityConfig)
+	if !ok {
+		if envs := commonConfig.NatsSecurityEnvsSet(); len(envs) != 0 {
+			return nil, errors.Errorf("nats security env %v is set, but config doesnt implement natsClient.SecurityConfig", envs)
+		}
+		return nil, nil
+	}
+
+	var opts []nats.Option
+
+	if caFile := secCfg.NatsTLSCAFile(); len(caFile) != 0 {
+		opts = append(opts, nats.RootCAs(caFile))
+	}
+
+	certFile, keyFile := secCfg.NatsTLSCertFile(), secCfg.NatsTLSKeyFile()
+	if len(certFile) != 0 || len(keyFile) != 0 {
+		if len(certFile) == 0 || len(keyFile) == 0 {
+			return nil, errors.New("both nats tls cert and key files must be set")
+		}
+		opts = append(opts, nats.ClientCert(certFile, keyFile))
+	}
+
+	if credsFile := secCfg.NatsCredsFile(); len(credsFile) != 0 {
+		opts = append(opts, nats.UserCredentials(credsFile))
+	}
+
+	if seedFile := secCfg.NatsNKeySeedFile(); len(seedFile) != 0 {
+		opt, err := nats.NkeyOptionFromSeed(seedFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load nats nkey seed")
+		}
+		opts = append(opts, opt)
+	}
+
+	if user := secCfg.NatsUser(); len(user) != 0 {
+		opts = append(opts, nats.UserInfo(user, secCfg.NatsPassword()))
+	}
+
+	if token := secCfg.NatsToken(); len(token) != 0 {
+		opts = append(opts, nats.Token(token))
+	}
+
+	return opts, nil
+}
+
+// connHooks дополнительные действия клиента на события соединения
+type connHooks struct {
+	onConnect func()
+	onClosed  func()
+}
+
+// connect общая настройка соединения для NewPubSub и NewJs, opts применяются последними
+func connect(cfg Config, log zerolog.Logger, hooks connHooks, opts ...nats.Option) (*nats.Conn, error) {
+	secOpts, err := securityOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	connOpts := []nats.Option{
+		nats.Name(cfg.NatsClientName()),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			if hooks.onConnect != nil {
+				hooks.onConnect()
+			}
+			log.Info().Msg("nats has been recconected")
+		}),
+		nats.ErrorHandler(func(c *nats.Conn, s *nats.Subscription, err error) {
+			if s == nil {
+				log.Info().Msgf("nats error handler: error occured: %v", err)
+				return
+			}
+			log.Info().Msgf("nats error handler: error occured: sub %s : %v", s.Subject, err)
+		}),
+		nats.DisconnectHandler(func(c *nats.Conn) {
+			log.Info().Msg("nats disconnect")
+		}),
+		nats.ClosedHandler(func(c *nats.Conn) {
+			if hooks.onClosed != nil {
+				hooks.onClosed()
+			}
+			log.Info().Msg("nats closed")
+		}),
+		nats.ConnectHandler(func(c *nats.Conn) {
+			if hooks.onConnect != nil {
+				hooks.onConnect()
+			}
+			log.Info().Msgf("nats successfully connected to %s", c.ConnectedAddr())
+		}),
+		nats.RetryOnFailedConnect(true),
+	}
+	connOpts = append(connOpts, secOpts...)
+	connOpts = append(connOpts, opts...)
+
+	conn, err := nats.Connect(cfg.NatsUrl(), connOpts...)
+	if err != nil {
+		log.Debug().Err(err).Msgf("failed to connect to nats (url: %s)", cfg.NatsUrl())
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,169 @@
+package natsClient
+
+import (
+	"context"
+	"strconv"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+)
+
+const (
+	DeadLetterHeaderError        = "Dlq-Error"
+	DeadLetterHeaderStream       = "Dlq-Stream"
+	DeadLetterHeaderConsumer     = "Dlq-Consumer"
+	DeadLetterHeaderSubject      = "Dlq-Subject"
+	DeadLetterHeaderNumDelivered = "Dlq-Num-Delivered"
+	DeadLetterHeaderStreamSeq    = "Dlq-Stream-Seq"
+)
+
+/*
+DeadLetterPolicy
+После MaxDeliveries неудачных доставок сообщение переотправляется в Subject
+(с заголовками Dlq-*) и терминируется.
+Если хендлер вернул mqClient.Terminate, сообщение уходит в DLQ сразу, без повторных
+доставок до MaxDeliveries (раньше такие сообщения тоже повторялись до лимита).
+MaxDeliveries должен быть меньше max_deliver консумера на сервере,
+иначе сервер перестанет доставлять сообщение раньше
+*/
+type DeadLetterPolicy struct {
+	MaxDeliveries uint64
+	Subject       string
+}
+
+type DeadLetterInfo struct {
+	Stream       string
+	Consumer     string
+	Subject      string
+	DlqSubject   string
+	NumDelivered uint64
+	StreamSeq    uint64
+	Data         []byte
+	Err          error
+}
+
+// DeadLetterHook вызывается после того, как сообщение было отправлено в DLQ
+type DeadLetterHook func(ctx context.Context, info DeadLetterInfo)
+
+type consumerKey struct {
+	stream   string
+	consumer string
+}
+
+type natsJsOptionDeadLetter struct {
+	key    consumerKey
+	policy DeadLetterPolicy
+}
+
+func (nd *natsJsOptionDeadLetter) Apply(opt *NatsClientJsOpts) {
+	if opt.deadLetterPolicies == nil {
+		opt.deadLetterPolicies = map[consumerKey]DeadLetterPolicy{}
+	}
+	opt.deadLetterPolicies[nd.key] = nd.policy
+}
+
+// WithDeadLetter задает DLQ политику для консумера consumerName на стриме streamName
+func WithDeadLetter(streamName string, consumerName string, policy DeadLetterPolicy) NatsClientJetStreamOption {
+	return &natsJsOptionDeadLetter{
+		key:    consumerKey{stream: streamName, consumer: consumerName},
+		policy: policy,
+	}
+}
+
+type natsJsOptionDeadLetterHook DeadLetterHook
+
+func (nh natsJsOptionDeadLetterHook) Apply(opt *NatsClientJsOpts) {
+	opt.deadLetterHook = DeadLetterHook(nh)
+}
+
+func WithDeadLetterHook(hook DeadLetterHook) NatsClientJetStreamOption {
+	return natsJsOptionDeadLetterHook(hook)
+}
+
+func (nc *NatsClientJetStream) deadLetterPolicy(streamName string, consumerName string) (DeadLetterPolicy, bool) {
+	policy, ok := nc.opts.deadLetterPolicies[consumerKey{stream: streamName, consumer: consumerName}]
+	if !ok || policy.MaxDeliveries == 0 || len(policy.Subject) == 0 {
+		return DeadLetterPolicy{}, false
+	}
+	return policy, true
+}
+
+/*
+moveToDeadLetterIfExhausted
+Возвращает true, если сообщение было отправлено в DLQ и терминировано.
+Сообщения, для которых хендлер вернул mqClient.Terminate, отправляются в DLQ сразу.
+Если количество доставок не превысило лимит или отправка в DLQ не удалась,
+возвращает false и сообщение должно обрабатываться как обычно
+*/
+func (nc *NatsClientJetStream) moveToDeadLetterIfExhausted(
+	ctx context.Context,
+	msg jetstream.Msg,
+	policy DeadLetterPolicy,
+	handleErr error,
+) bool {
+	log := logger.From(ctx)
+
+	meta, err := msg.Metadata()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get message metadata")
+		return false
+	}
+
+	if meta.NumDelivered < policy.MaxDeliveries && !mqClient.IsTerminateError(handleErr) {
+		return false
+	}
+
+	dlqMsg := newDeadLetterMsg(msg, meta, policy, handleErr)
+
+	if _, err := nc.js.PublishMsg(ctx, dlqMsg); err != nil {
+		log.Error().Err(errors.WithStack(err)).Msgf("failed to publish message into dead letter subject %s", policy.Subject)
+		return false
+	}
+
+	if err := msg.TermWithReason("max deliveries exceeded"); err != nil {
+		log.Error().Err(err).Msgf("failed to term msg %s", msg.Data())
+	}
+
+	log.Warn().Fields(map[string]interface{}{
+		"stream":       meta.Stream,
+		"consumer":     meta.Consumer,
+		"numDelivered": meta.NumDelivered,
+		"dlqSubject":   policy.Subject,
+	}).Msg("message moved into dead letter subject")
+
+	if nc.opts.deadLetterHook != nil {
+		nc.opts.deadLetterHook(ctx, DeadLetterInfo{
+			Stream:       meta.Stream,
+			Consumer:     meta.Consumer,
+			Subject:      msg.Subject(),
+			DlqSubject:   policy.Subject,
+			NumDelivered: meta.NumDelivered,
+			StreamSeq:    meta.Sequence.Stream,
+			Data:         msg.Data(),
+			Err:          handleErr,
+		})
+	}
+	return true
+}
+
+// newDeadLetterMsg копия сообщения для DLQ: исходные заголовки и Dlq-* с причиной и позицией в стриме
+func newDeadLetterMsg(msg jetstream.Msg, meta *jetstream.MsgMetadata, policy DeadLetterPolicy, handleErr error) *nats.Msg {
+	dlqMsg := &nats.Msg{
+		Subject: policy.Subject,
+		Data:    msg.Data(),
+		Header:  nats.Header{},
+	}
+	for k, v := range msg.Headers() {
+		dlqMsg.Header[k] = v
+	}
+	dlqMsg.Header.Set(DeadLetterHeaderError, handleErr.Error())
+	dlqMsg.Header.Set(DeadLetterHeaderStream, meta.Stream)
+	dlqMsg.Header.Set(DeadLetterHeaderConsumer, meta.Consumer)
+	dlqMsg.Header.Set(DeadLetterHeaderSubject, msg.Subject())
+	dlqMsg.Header.Set(DeadLetterHeaderNumDelivered, strconv.FormatUint(meta.NumDelivered, 10))
+	dlqMsg.Header.Set(DeadLetterHeaderStreamSeq, strconv.FormatUint(meta.Sequence.Stream, 10))
+	return dlqMsg
+}
@@ -0,0 +1,67 @@
+package natsClient
+
+import (
+	"testing"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+)
+
+// fakeJsMsg реализует только методы jetstream.Msg, которые нужны для сборки DLQ сообщения
+type fakeJsMsg struct {
+	jetstream.Msg
+
+	subject string
+	data    []byte
+	headers nats.Header
+}
+
+func (m *fakeJsMsg) Subject() string      { return m.subject }
+func (m *fakeJsMsg) Data() []byte         { return m.data }
+func (m *fakeJsMsg) Headers() nats.Header { return m.headers }
+
+func TestNewDeadLetterMsg(t *testing.T) {
+	msg := &fakeJsMsg{
+		subject: "media.usage",
+		data:    []byte(`{"mediaUid":"m1"}`),
+		headers: nats.Header{
+			"Traceparent":               {"00-trace-span-01"},
+			mqClient.HeaderPartitionKey: {"media-1"},
+		},
+	}
+	meta := &jetstream.MsgMetadata{
+		Stream:       "media",
+		Consumer:     "usage_consumer",
+		NumDelivered: 5,
+		Sequence:     jetstream.SequencePair{Stream: 42, Consumer: 7},
+	}
+	policy := DeadLetterPolicy{MaxDeliveries: 5, Subject: "media.dlq"}
+
+	dlqMsg := newDeadLetterMsg(msg, meta, policy, mqClient.Terminate(errors.New("invalid payload")))
+
+	if dlqMsg.Subject != "media.dlq" || string(dlqMsg.Data) != string(msg.data) {
+		t.Errorf("dlq msg = %s %s", dlqMsg.Subject, dlqMsg.Data)
+	}
+
+	wantHeaders := map[string]string{
+		"Traceparent":                "00-trace-span-01",
+		mqClient.HeaderPartitionKey:  "media-1",
+		DeadLetterHeaderError:        "terminate: invalid payload",
+		DeadLetterHeaderStream:       "media",
+		DeadLetterHeaderConsumer:     "usage_consumer",
+		DeadLetterHeaderSubject:      "media.usage",
+		DeadLetterHeaderNumDelivered: "5",
+		DeadLetterHeaderStreamSeq:    "42",
+	}
+	for k, want := range wantHeaders {
+		if got := dlqMsg.Header.Get(k); got != want {
+			t.Errorf("header %s = %q, want %q", k, got, want)
+		}
+	}
+
+	if len(msg.headers.Get(DeadLetterHeaderError)) != 0 {
+		t.Error("dlq headers written into original message headers")
+	}
+}
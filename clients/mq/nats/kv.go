@@ -0,0 +1,273 @@
+package natsClient
+
+import (
+	"context"
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	commonConfig "github.com/balobas/sport_city_common/config"
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrKVBucketNotFound = jetstream.ErrBucketNotFound
+	ErrKVKeyNotFound    = jetstream.ErrKeyNotFound
+	// ErrKVKeyExists возвращается Create, если ключ уже есть
+	ErrKVKeyExists = jetstream.ErrKeyExists
+	// ErrKVRevisionMismatch возвращается Update/Delete, если ревизия ключа изменилась
+	ErrKVRevisionMismatch = errors.New("kv revision mismatch")
+)
+
+/*
+KVBucketSpec
+Описание KV бакета для провиженинга (WithKVBuckets, ProvisionKV):
+
+	{"name": "feature_flags", "history": 5, "ttl": "24h", "replicas": 3}
+*/
+type KVBucketSpec struct {
+	Name         string                `json:"name"`
+	Description  string                `json:"description"`
+	History      uint8                 `json:"history"`
+	TTL          commonConfig.Duration `json:"ttl"`
+	MaxValueSize int32                 `json:"maxValueSize"`
+	Storage      jetstream.StorageType `json:"storage"`
+	Replicas     int                   `json:"replicas"`
+}
+
+func (s KVBucketSpec) toKeyValueConfig() jetstream.KeyValueConfig {
+	replicas := s.Replicas
+	if replicas < 1 {
+		replicas = 1
+	}
+
+	return jetstream.KeyValueConfig{
+		Bucket:       s.Name,
+		Description:  s.Description,
+		History:      s.History,
+		TTL:          s.TTL.Duration,
+		MaxValueSize: s.MaxValueSize,
+		Storage:      s.Storage,
+		Replicas:     replicas,
+	}
+}
+
+type natsJsOptionKVBuckets []KVBucketSpec
+
+func (nk natsJsOptionKVBuckets) Apply(opt *NatsClientJsOpts) {
+	opt.kvBucketSpecs = append(opt.kvBucketSpecs, nk...)
+}
+
+// WithKVBuckets создает или обновляет KV бакеты при инициализации клиента (NewJs)
+func WithKVBuckets(specs ...KVBucketSpec) NatsClientJetStreamOption {
+	return natsJsOptionKVBuckets(specs)
+}
+
+// ProvisionKV создает или обновляет KV бакеты по спекам
+func (nc *NatsClientJetStream) ProvisionKV(ctx context.Context, specs ...KVBucketSpec) error {
+	log := logger.From(ctx).With().Fields(map[string]interface{}{
+		"component": "NatsClientJetStream",
+		"method":    "ProvisionKV",
+	}).Logger()
+
+	for _, spec := range specs {
+		if _, err := nc.js.CreateOrUpdateKeyValue(ctx, spec.toKeyValueConfig()); err != nil {
+			return errors.Wrapf(err, "failed to create or update kv bucket %s", spec.Name)
+		}
+		log.Info().Msgf("kv bucket %s provisioned", spec.Name)
+	}
+	return nil
+}
+
+type KVOperation string
+
+const (
+	KVOperationPut    KVOperation = "put"
+	KVOperationDelete KVOperation = "delete"
+)
+
+type KVEntry[T any] struct {
+	Key      string
+	Value    T
+	Revision uint64
+	Created  time.Time
+	// Operation для Watch: put или delete (у delete Value пустой)
+	Operation KVOperation
+}
+
+/*
+KV
+Типизированная обертка над JetStream KV бакетом.
+Значения кодируются codec (mqClient.JSONCodec, mqClient.ProtoCodec):
+
+	flags, err := natsClient.NewKV[FeatureFlags](ctx, nc, "feature_flags", mqClient.JSONCodec{})
+	entry, err := flags.Get(ctx, "media")
+	_, err = flags.Update(ctx, "media", newFlags, entry.Revision)
+*/
+type KV[T any] struct {
+	bucket string
+	kv     jetstream.KeyValue
+	codec  mqClient.Codec
+}
+
+// NewKV бакет должен существовать (WithKVBuckets или ProvisionKV), иначе ErrKVBucketNotFound
+func NewKV[T any](ctx context.Context, nc *NatsClientJetStream, bucket string, codec mqClient.Codec) (*KV[T], error) {
+	kv, err := nc.js.KeyValue(ctx, bucket)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get kv bucket %s", bucket)
+	}
+
+	return &KV[T]{
+		bucket: bucket,
+		kv:     kv,
+		codec:  codec,
+	}, nil
+}
+
+func (k *KV[T]) Get(ctx context.Context, key string) (KVEntry[T], error) {
+	entry, err := k.kv.Get(ctx, key)
+	if err != nil {
+		return KVEntry[T]{}, errors.Wrapf(err, "failed to get key %s from kv bucket %s", key, k.bucket)
+	}
+	return k.decodeEntry(entry)
+}
+
+// Put записывает значение без проверки ревизии, возвращает новую ревизию
+func (k *KV[T]) Put(ctx context.Context, key string, value T) (uint64, error) {
+	data, err := k.codec.Marshal(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to encode value for key %s", key)
+	}
+
+	revision, err := k.kv.Put(ctx, key, data)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to put key %s into kv bucket %s", key, k.bucket)
+	}
+	return revision, nil
+}
+
+// Create записывает значение, только если ключа нет (или он удален), иначе ErrKVKeyExists
+func (k *KV[T]) Create(ctx context.Context, key string, value T) (uint64, error) {
+	data, err := k.codec.Marshal(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to encode value for key %s", key)
+	}
+
+	revision, err := k.kv.Create(ctx, key, data)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to create key %s in kv bucket %s", key, k.bucket)
+	}
+	return revision, nil
+}
+
+// Update compare-and-set: записывает значение, только если текущая ревизия ключа равна lastRevision
+func (k *KV[T]) Update(ctx context.Context, key string, value T, lastRevision uint64) (uint64, error) {
+	data, err := k.codec.Marshal(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to encode value for key %s", key)
+	}
+
+	revision, err := k.kv.Update(ctx, key, data, lastRevision)
+	if err != nil {
+		return 0, errors.Wrapf(kvRevisionError(err), "failed to update key %s in kv bucket %s", key, k.bucket)
+	}
+	return revision, nil
+}
+
+// Delete удаляет ключ. Если lastRevision != 0, удаление выполняется только при совпадении ревизии
+func (k *KV[T]) Delete(ctx context.Context, key string, lastRevision uint64) error {
+	var opts []jetstream.KVDeleteOpt
+	if lastRevision != 0 {
+		opts = append(opts, jetstream.LastRevision(lastRevision))
+	}
+
+	if err := k.kv.Delete(ctx, key, opts...); err != nil {
+		return errors.Wrapf(kvRevisionError(err), "failed to delete key %s from kv bucket %s", key, k.bucket)
+	}
+	return nil
+}
+
+/*
+Watch
+Отдает текущие значения ключей, подходящих под keys (поддерживаются * и >), и дальнейшие изменения.
+Канал закрывается после завершения ctx. Значения, которые не удалось декодировать, пропускаются
+*/
+func (k *KV[T]) Watch(ctx context.Context, keys string, opts ...jetstream.WatchOpt) (<-chan KVEntry[T], error) {
+	log := logger.From(ctx).With().Fields(map[string]interface{}{
+		"component": "natsKV",
+		"bucket":    k.bucket,
+		"keys":      keys,
+	}).Logger()
+
+	watcher, err := k.kv.Watch(ctx, keys, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to watch keys %s in kv bucket %s", keys, k.bucket)
+	}
+
+	entries := make(chan KVEntry[T])
+	go func() {
+		defer close(entries)
+		defer func() {
+			if err := watcher.Stop(); err != nil {
+				log.Warn().Err(err).Msg("failed to stop kv watcher")
+			}
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case entry, ok := <-watcher.Updates():
+				if !ok {
+					return
+				}
+				// nil - маркер окончания начальных значений
+				if entry == nil {
+					continue
+				}
+
+				decoded, err := k.decodeEntry(entry)
+				if err != nil {
+					log.Error().Err(err).Msgf("skip kv entry %s revision %d", entry.Key(), entry.Revision())
+					continue
+				}
+
+				select {
+				case entries <- decoded:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return entries, nil
+}
+
+func (k *KV[T]) decodeEntry(entry jetstream.KeyValueEntry) (KVEntry[T], error) {
+	res := KVEntry[T]{
+		Key:       entry.Key(),
+		Revision:  entry.Revision(),
+		Created:   entry.Created(),
+		Operation: KVOperationPut,
+	}
+
+	if entry.Operation() != jetstream.KeyValuePut {
+		res.Operation = KVOperationDelete
+		return res, nil
+	}
+
+	if err := k.codec.Unmarshal(entry.Value(), &res.Value); err != nil {
+		return KVEntry[T]{}, errors.Wrapf(err, "failed to decode value of key %s", entry.Key())
+	}
+	return res, nil
+}
+
+func kvRevisionError(err error) error {
+	var apiErr *jetstream.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode == jetstream.JSErrCodeStreamWrongLastSequence {
+		return errors.Wrap(ErrKVRevisionMismatch, err.Error())
+	}
+	return err
+}
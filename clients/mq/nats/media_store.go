@@ -0,0 +1,258 @@
+package natsClient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	outboxEntity "github.com/balobas/sport_city_common/entity/outbox"
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	mediaMetaFileName = "file-name"
+
+	// maxUsageUpdateAttempts попыток compare-and-set записи использования при конкурентных обновлениях
+	maxUsageUpdateAttempts = 10
+)
+
+/*
+MediaUsage
+Запись использования медиа в KV: домены (сервисы), которые ссылаются на медиа,
+и с какого момента на него никто не ссылается
+*/
+type MediaUsage struct {
+	Domains     []string  `json:"domains,omitempty"`
+	UnusedSince time.Time `json:"unusedSince"`
+}
+
+func (u *MediaUsage) addDomain(domain string) {
+	for _, d := range u.Domains {
+		if d == domain {
+			return
+		}
+	}
+	u.Domains = append(u.Domains, domain)
+}
+
+func (u *MediaUsage) removeDomain(domain string) {
+	domains := u.Domains[:0]
+	for _, d := range u.Domains {
+		if d != domain {
+			domains = append(domains, d)
+		}
+	}
+	u.Domains = domains
+}
+
+func (u *MediaUsage) markUnusedIfFree(now time.Time) {
+	if len(u.Domains) == 0 && u.UnusedSince.IsZero() {
+		u.UnusedSince = now
+	}
+}
+
+/*
+MediaStore
+Хранилище медиа файлов поверх ObjectStore. Объект называется uid медиа.
+Использование хранится в KV бакете (ключ - uid медиа) как набор доменов, которые ссылаются
+на медиа, и обновляется compare-and-set по ревизии. Медиа считается неиспользуемым,
+только когда на него не ссылается ни один домен. События использования для медиа,
+которое еще не загружено, сохраняются и учитываются после Put.
+CleanupUnused удаляет файлы, которые не используются дольше ttl:
+
+	store, err := natsClient.NewObjectStore(ctx, nc, "media")
+	usage, err := natsClient.NewKV[natsClient.MediaUsage](ctx, nc, "media_usage", mqClient.JSONCodec{})
+	mediaStore := natsClient.NewMediaStore(store, usage)
+*/
+type MediaStore struct {
+	store *ObjectStore
+	usage *KV[MediaUsage]
+}
+
+func NewMediaStore(store *ObjectStore, usage *KV[MediaUsage]) *MediaStore {
+	return &MediaStore{
+		store: store,
+		usage: usage,
+	}
+}
+
+// Put загружает файл. Если до загрузки не пришло событие использования, файл считается неиспользуемым
+func (ms *MediaStore) Put(ctx context.Context, mediaUid uuid.UUID, fileName string, reader io.Reader) (ObjectInfo, error) {
+	info, err := ms.store.Put(ctx, ObjectMeta{
+		Name: mediaUid.String(),
+		Metadata: map[string]string{
+			mediaMetaFileName: fileName,
+		},
+	}, reader)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	if err := ms.updateUsage(ctx, mediaUid, func(usage *MediaUsage) {
+		usage.markUnusedIfFree(time.Now().UTC())
+	}); err != nil {
+		return info, err
+	}
+	return info, nil
+}
+
+func (ms *MediaStore) Get(ctx context.Context, mediaUid uuid.UUID) (io.ReadCloser, ObjectInfo, error) {
+	return ms.store.Get(ctx, mediaUid.String())
+}
+
+func (ms *MediaStore) Delete(ctx context.Context, mediaUid uuid.UUID) error {
+	if err := ms.store.Delete(ctx, mediaUid.String()); err != nil {
+		return err
+	}
+	if err := ms.usage.Delete(ctx, mediaUid.String(), 0); err != nil && !errors.Is(err, ErrKVKeyNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Usage запись использования медиа, ErrKVKeyNotFound, если событий использования не было и файл не загружался
+func (ms *MediaStore) Usage(ctx context.Context, mediaUid uuid.UUID) (MediaUsage, error) {
+	entry, err := ms.usage.Get(ctx, mediaUid.String())
+	if err != nil {
+		return MediaUsage{}, err
+	}
+	return entry.Value, nil
+}
+
+// MarkUsed добавляет domain к сервисам, которые используют медиа
+func (ms *MediaStore) MarkUsed(ctx context.Context, domain string, mediaUid uuid.UUID) error {
+	return ms.updateUsage(ctx, mediaUid, func(usage *MediaUsage) {
+		usage.addDomain(domain)
+		usage.UnusedSince = time.Time{}
+	})
+}
+
+// MarkUnused убирает domain из сервисов, которые используют медиа. Медиа без ссылок помечается неиспользуемым
+func (ms *MediaStore) MarkUnused(ctx context.Context, domain string, mediaUid uuid.UUID) error {
+	return ms.updateUsage(ctx, mediaUid, func(usage *MediaUsage) {
+		usage.removeDomain(domain)
+		usage.markUnusedIfFree(time.Now().UTC())
+	})
+}
+
+// updateUsage compare-and-set записи использования, при конкурентном изменении запись перечитывается
+func (ms *MediaStore) updateUsage(ctx context.Context, mediaUid uuid.UUID, update func(usage *MediaUsage)) error {
+	key := mediaUid.String()
+
+	for attempt := 0; attempt < maxUsageUpdateAttempts; attempt++ {
+		entry, err := ms.usage.Get(ctx, key)
+		if errors.Is(err, ErrKVKeyNotFound) {
+			var usage MediaUsage
+			update(&usage)
+
+			_, err := ms.usage.Create(ctx, key, usage)
+			if isUsageConflict(err) {
+				continue
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		usage := entry.Value
+		update(&usage)
+
+		_, err = ms.usage.Update(ctx, key, usage, entry.Revision)
+		if isUsageConflict(err) {
+			continue
+		}
+		return err
+	}
+	return errors.Wrapf(ErrKVRevisionMismatch, "media %s usage: too many concurrent updates", key)
+}
+
+func isUsageConflict(err error) bool {
+	return err != nil && (errors.Is(err, ErrKVKeyExists) || errors.Is(kvRevisionError(err), ErrKVRevisionMismatch))
+}
+
+/*
+HandleMediaUsage
+Хендлер событий MediaUsagePayload (CreateMediaUsageMessage) для консумера медиа сервиса.
+События для медиа, которое еще не загружено, сохраняются в записи использования
+*/
+func (ms *MediaStore) HandleMediaUsage(ctx context.Context, msgPayload []byte) error {
+	var payload outboxEntity.MediaUsagePayload
+	if err := json.Unmarshal(msgPayload, &payload); err != nil {
+		return mqClient.Terminate(errors.Wrap(err, "failed to decode media usage payload"))
+	}
+
+	for _, mediaUid := range payload.FirstlyUsed {
+		if err := ms.MarkUsed(ctx, payload.Domain, mediaUid); err != nil {
+			return err
+		}
+	}
+
+	for _, mediaUid := range payload.Unused {
+		if err := ms.MarkUnused(ctx, payload.Domain, mediaUid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+CleanupUnused
+Удаляет медиа, на которые никто не ссылается дольше ttl, возвращает количество удаленных.
+Запись использования удаляется с проверкой ревизии до удаления файла, поэтому медиа,
+которое начали использовать во время очистки, не удаляется. Если файл удалить не удалось,
+запись восстанавливается
+*/
+func (ms *MediaStore) CleanupUnused(ctx context.Context, ttl time.Duration) (int, error) {
+	log := logger.From(ctx).With().Str("component", "natsMediaStore").Logger()
+
+	infos, err := ms.store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	threshold := now.Add(-ttl)
+	var deleted int
+	for _, info := range infos {
+		entry, err := ms.usage.Get(ctx, info.Name)
+		if errors.Is(err, ErrKVKeyNotFound) {
+			// файл без записи использования (запись не успела создаться в Put) - отсчет ttl с текущего момента
+			if _, err := ms.usage.Create(ctx, info.Name, MediaUsage{UnusedSince: now}); err != nil && !isUsageConflict(err) {
+				log.Warn().Err(err).Msgf("failed to create usage of media %s", info.Name)
+			}
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+
+		usage := entry.Value
+		if len(usage.Domains) != 0 || usage.UnusedSince.IsZero() || usage.UnusedSince.After(threshold) {
+			continue
+		}
+
+		if err := ms.usage.Delete(ctx, info.Name, entry.Revision); err != nil {
+			if errors.Is(err, ErrKVRevisionMismatch) {
+				log.Info().Msgf("usage of media %s changed during cleanup, skip", info.Name)
+				continue
+			}
+			return deleted, err
+		}
+
+		if err := ms.store.Delete(ctx, info.Name); err != nil {
+			// запись возвращается с прежним UnusedSince, иначе следующая очистка начнет отсчет ttl заново
+			if _, restoreErr := ms.usage.Create(ctx, info.Name, usage); restoreErr != nil && !isUsageConflict(restoreErr) {
+				log.Warn().Err(restoreErr).Msgf("failed to restore usage of media %s", info.Name)
+			}
+			return deleted, err
+		}
+		deleted++
+		log.Info().Msgf("unused media %s deleted, unused since %s", info.Name, usage.UnusedSince.Format(time.RFC3339))
+	}
+	return deleted, nil
+}
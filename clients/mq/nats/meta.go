@@ -0,0 +1,34 @@
+package natsClient
+
+import (
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func natsMsgMeta(msg *nats.Msg) mqClient.Meta {
+	return mqClient.Meta{
+		Subject: msg.Subject,
+		Headers: msg.Header,
+	}
+}
+
+func jsMsgMeta(msg jetstream.Msg) mqClient.Meta {
+	meta := mqClient.Meta{
+		Subject: msg.Subject(),
+		Headers: msg.Headers(),
+	}
+
+	jsMeta, err := msg.Metadata()
+	if err != nil {
+		return meta
+	}
+
+	meta.Stream = jsMeta.Stream
+	meta.Consumer = jsMeta.Consumer
+	meta.NumDelivered = jsMeta.NumDelivered
+	meta.StreamSeq = jsMeta.Sequence.Stream
+	meta.ConsumerSeq = jsMeta.Sequence.Consumer
+	meta.Timestamp = jsMeta.Timestamp
+	return meta
+}
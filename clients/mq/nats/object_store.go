@@ -0,0 +1,277 @@
+package natsClient
+
+import (
+	"context"
+	"io"
+	"time"
+
+	commonConfig "github.com/balobas/sport_city_common/config"
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrObjectStoreNotFound = jetstream.ErrBucketNotFound
+	ErrObjectNotFound      = jetstream.ErrObjectNotFound
+)
+
+/*
+ObjectStoreSpec
+Описание бакета object store для провиженинга (WithObjectStores, ProvisionObjectStores).
+TTL - время жизни объектов в бакете, 0 - без ограничения:
+
+	{"name": "media", "maxBytes": 10737418240, "replicas": 3}
+*/
+type ObjectStoreSpec struct {
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	TTL         commonConfig.Duration `json:"ttl"`
+	MaxBytes    int64                 `json:"maxBytes"`
+	Storage     jetstream.StorageType `json:"storage"`
+	Replicas    int                   `json:"replicas"`
+}
+
+func (s ObjectStoreSpec) toObjectStoreConfig() jetstream.ObjectStoreConfig {
+	replicas := s.Replicas
+	if replicas < 1 {
+		replicas = 1
+	}
+
+	maxBytes := s.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = -1
+	}
+
+	return jetstream.ObjectStoreConfig{
+		Bucket:      s.Name,
+		Description: s.Description,
+		TTL:         s.TTL.Duration,
+		MaxBytes:    maxBytes,
+		Storage:     s.Storage,
+		Replicas:    replicas,
+	}
+}
+
+type natsJsOptionObjectStores []ObjectStoreSpec
+
+func (no natsJsOptionObjectStores) Apply(opt *NatsClientJsOpts) {
+	opt.objectStoreSpecs = append(opt.objectStoreSpecs, no...)
+}
+
+// WithObjectStores создает или обновляет бакеты object store при инициализации клиента (NewJs)
+func WithObjectStores(specs ...ObjectStoreSpec) NatsClientJetStreamOption {
+	return natsJsOptionObjectStores(specs)
+}
+
+// ProvisionObjectStores создает или обновляет бакеты object store по спекам
+func (nc *NatsClientJetStream) ProvisionObjectStores(ctx context.Context, specs ...ObjectStoreSpec) error {
+	log := logger.From(ctx).With().Fields(map[string]interface{}{
+		"component": "NatsClientJetStream",
+		"method":    "ProvisionObjectStores",
+	}).Logger()
+
+	for _, spec := range specs {
+		if _, err := nc.js.CreateOrUpdateObjectStore(ctx, spec.toObjectStoreConfig()); err != nil {
+			return errors.Wrapf(err, "failed to create or update object store %s", spec.Name)
+		}
+		log.Info().Msgf("object store %s provisioned", spec.Name)
+	}
+	return nil
+}
+
+type ObjectMeta struct {
+	Name        string
+	Description string
+	Metadata    map[string]string
+}
+
+type ObjectInfo struct {
+	ObjectMeta
+	Bucket  string
+	Size    uint64
+	ModTime time.Time
+	Digest  string
+	Deleted bool
+	// LinkTo имя объекта, на который ссылается линк (пустое, если объект не линк)
+	LinkTo string
+}
+
+func toObjectInfo(info *jetstream.ObjectInfo) ObjectInfo {
+	res := ObjectInfo{
+		ObjectMeta: ObjectMeta{
+			Name:        info.Name,
+			Description: info.Description,
+			Metadata:    info.Metadata,
+		},
+		Bucket:  info.Bucket,
+		Size:    info.Size,
+		ModTime: info.ModTime,
+		Digest:  info.Digest,
+		Deleted: info.Deleted,
+	}
+	if info.Opts != nil && info.Opts.Link != nil {
+		res.LinkTo = info.Opts.Link.Name
+	}
+	return res
+}
+
+/*
+ObjectStore
+Обертка над JetStream Object Store бакетом. Объекты читаются и пишутся потоково,
+большие файлы не загружаются в память целиком
+*/
+type ObjectStore struct {
+	bucket string
+	store  jetstream.ObjectStore
+}
+
+// NewObjectStore бакет должен существовать (WithObjectStores или ProvisionObjectStores), иначе ErrObjectStoreNotFound
+func NewObjectStore(ctx context.Context, nc *NatsClientJetStream, bucket string) (*ObjectStore, error) {
+	store, err := nc.js.ObjectStore(ctx, bucket)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get object store %s", bucket)
+	}
+
+	return &ObjectStore{
+		bucket: bucket,
+		store:  store,
+	}, nil
+}
+
+// Put записывает объект из reader, существующий объект с тем же именем заменяется
+func (o *ObjectStore) Put(ctx context.Context, meta ObjectMeta, reader io.Reader) (ObjectInfo, error) {
+	info, err := o.store.Put(ctx, jetstream.ObjectMeta{
+		Name:        meta.Name,
+		Description: meta.Description,
+		Metadata:    meta.Metadata,
+	}, reader)
+	if err != nil {
+		return ObjectInfo{}, errors.Wrapf(err, "failed to put object %s into object store %s", meta.Name, o.bucket)
+	}
+	return toObjectInfo(info), nil
+}
+
+// Get открывает объект на чтение (линки разрешаются), reader нужно закрыть
+func (o *ObjectStore) Get(ctx context.Context, name string) (io.ReadCloser, ObjectInfo, error) {
+	res, err := o.store.Get(ctx, name)
+	if err != nil {
+		return nil, ObjectInfo{}, errors.Wrapf(err, "failed to get object %s from object store %s", name, o.bucket)
+	}
+
+	info, err := res.Info()
+	if err != nil {
+		res.Close()
+		return nil, ObjectInfo{}, errors.Wrapf(err, "failed to get object %s info from object store %s", name, o.bucket)
+	}
+	return res, toObjectInfo(info), nil
+}
+
+func (o *ObjectStore) GetInfo(ctx context.Context, name string) (ObjectInfo, error) {
+	info, err := o.store.GetInfo(ctx, name)
+	if err != nil {
+		return ObjectInfo{}, errors.Wrapf(err, "failed to get object %s info from object store %s", name, o.bucket)
+	}
+	return toObjectInfo(info), nil
+}
+
+// UpdateMeta заменяет описание и метаданные объекта, meta.Name позволяет переименовать объект
+func (o *ObjectStore) UpdateMeta(ctx context.Context, name string, meta ObjectMeta) error {
+	err := o.store.UpdateMeta(ctx, name, jetstream.ObjectMeta{
+		Name:        meta.Name,
+		Description: meta.Description,
+		Metadata:    meta.Metadata,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to update object %s meta in object store %s", name, o.bucket)
+	}
+	return nil
+}
+
+func (o *ObjectStore) Delete(ctx context.Context, name string) error {
+	if err := o.store.Delete(ctx, name); err != nil {
+		return errors.Wrapf(err, "failed to delete object %s from object store %s", name, o.bucket)
+	}
+	return nil
+}
+
+// List все неудаленные объекты бакета
+func (o *ObjectStore) List(ctx context.Context) ([]ObjectInfo, error) {
+	infos, err := o.store.List(ctx)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrNoObjectsFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to list objects in object store %s", o.bucket)
+	}
+
+	res := make([]ObjectInfo, 0, len(infos))
+	for _, info := range infos {
+		res = append(res, toObjectInfo(info))
+	}
+	return res, nil
+}
+
+// AddLink создает объект name, ссылающийся на объект target того же бакета
+func (o *ObjectStore) AddLink(ctx context.Context, name string, target string) (ObjectInfo, error) {
+	targetInfo, err := o.store.GetInfo(ctx, target)
+	if err != nil {
+		return ObjectInfo{}, errors.Wrapf(err, "failed to get link target %s info from object store %s", target, o.bucket)
+	}
+
+	info, err := o.store.AddLink(ctx, name, targetInfo)
+	if err != nil {
+		return ObjectInfo{}, errors.Wrapf(err, "failed to add link %s to %s in object store %s", name, target, o.bucket)
+	}
+	return toObjectInfo(info), nil
+}
+
+/*
+Watch
+Отдает текущее состояние объектов бакета и дальнейшие изменения (в том числе удаления, Deleted = true).
+Канал закрывается после завершения ctx
+*/
+func (o *ObjectStore) Watch(ctx context.Context, opts ...jetstream.WatchOpt) (<-chan ObjectInfo, error) {
+	log := logger.From(ctx).With().Fields(map[string]interface{}{
+		"component": "natsObjectStore",
+		"bucket":    o.bucket,
+	}).Logger()
+
+	watcher, err := o.store.Watch(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to watch object store %s", o.bucket)
+	}
+
+	infos := make(chan ObjectInfo)
+	go func() {
+		defer close(infos)
+		defer func() {
+			if err := watcher.Stop(); err != nil {
+				log.Warn().Err(err).Msg("failed to stop object store watcher")
+			}
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case info, ok := <-watcher.Updates():
+				if !ok {
+					return
+				}
+				// nil - маркер окончания начального состояния
+				if info == nil {
+					continue
+				}
+
+				select {
+				case infos <- toObjectInfo(info):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return infos, nil
+}
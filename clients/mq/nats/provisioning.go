@@ -0,0 +1,195 @@
+package natsClient
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	commonConfig "github.com/balobas/sport_city_common/config"
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+)
+
+/*
+StreamSpec
+Декларативное описание стрима и его durable консумеров.
+Можно собрать в коде или распарсить из json конфига:
+
+	{
+		"name": "media",
+		"subjects": ["media.*"],
+		"retention": "workqueue",
+		"maxAge": "72h",
+		"replicas": 3,
+		"consumers": [
+			{"name": "media_usage_consumer", "ackWait": "30s", "maxDeliver": 10, "filterSubjects": ["media.usage"]}
+		]
+	}
+*/
+type StreamSpec struct {
+	Name             string                    `json:"name"`
+	Subjects         []string                  `json:"subjects"`
+	Retention        jetstream.RetentionPolicy `json:"retention"`
+	Storage          jetstream.StorageType     `json:"storage"`
+	MaxAge           commonConfig.Duration     `json:"maxAge"`
+	Replicas         int                       `json:"replicas"`
+	DuplicatesWindow commonConfig.Duration     `json:"duplicatesWindow"`
+	Consumers        []ConsumerSpec            `json:"consumers"`
+}
+
+type ConsumerSpec struct {
+	Name           string                  `json:"name"`
+	DeliverPolicy  jetstream.DeliverPolicy `json:"deliverPolicy"`
+	AckWait        commonConfig.Duration   `json:"ackWait"`
+	MaxDeliver     int                     `json:"maxDeliver"`
+	MaxAckPending  int                     `json:"maxAckPending"`
+	FilterSubjects []string                `json:"filterSubjects"`
+}
+
+func (s StreamSpec) toStreamConfig() jetstream.StreamConfig {
+	replicas := s.Replicas
+	if replicas < 1 {
+		replicas = 1
+	}
+
+	return jetstream.StreamConfig{
+		Name:       s.Name,
+		Subjects:   s.Subjects,
+		Retention:  s.Retention,
+		Storage:    s.Storage,
+		MaxAge:     s.MaxAge.Duration,
+		Replicas:   replicas,
+		Duplicates: s.DuplicatesWindow.Duration,
+	}
+}
+
+func (c ConsumerSpec) toConsumerConfig() jetstream.ConsumerConfig {
+	cfg := jetstream.ConsumerConfig{
+		Durable:       c.Name,
+		DeliverPolicy: c.DeliverPolicy,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       c.AckWait.Duration,
+		MaxDeliver:    c.MaxDeliver,
+		MaxAckPending: c.MaxAckPending,
+	}
+
+	if len(c.FilterSubjects) == 1 {
+		cfg.FilterSubject = c.FilterSubjects[0]
+	} else {
+		cfg.FilterSubjects = c.FilterSubjects
+	}
+	return cfg
+}
+
+type natsJsOptionProvisioning []StreamSpec
+
+func (np natsJsOptionProvisioning) Apply(opt *NatsClientJsOpts) {
+	opt.streamSpecs = append(opt.streamSpecs, np...)
+}
+
+// WithProvisioning создает или обновляет стримы и консумеры при инициализации клиента (NewJs)
+func WithProvisioning(specs ...StreamSpec) NatsClientJetStreamOption {
+	return natsJsOptionProvisioning(specs)
+}
+
+/*
+Provision
+Создает или обновляет стримы и консумеры по спекам.
+Перед обновлением сравнивает спеку с текущей конфигурацией на сервере и логирует расхождения
+*/
+func (nc *NatsClientJetStream) Provision(ctx context.Context, specs ...StreamSpec) error {
+	log := logger.From(ctx).With().Fields(map[string]interface{}{
+		"component": "NatsClientJetStream",
+		"method":    "Provision",
+	}).Logger()
+
+	for _, spec := range specs {
+		streamCfg := spec.toStreamConfig()
+
+		stream, err := nc.js.Stream(ctx, spec.Name)
+		switch {
+		case err == nil:
+			if drift := streamConfigDrift(stream.CachedInfo().Config, streamCfg); len(drift) != 0 {
+				log.Warn().Strs("drift", drift).Msgf("stream %s config differs from spec, updating", spec.Name)
+			}
+		case errors.Is(err, jetstream.ErrStreamNotFound):
+			log.Info().Msgf("stream %s not found, creating", spec.Name)
+		default:
+			return errors.Wrapf(err, "failed to get stream %s", spec.Name)
+		}
+
+		stream, err = nc.js.CreateOrUpdateStream(ctx, streamCfg)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create or update stream %s", spec.Name)
+		}
+
+		for _, consumerSpec := range spec.Consumers {
+			consumerCfg := consumerSpec.toConsumerConfig()
+
+			consumer, err := stream.Consumer(ctx, consumerSpec.Name)
+			switch {
+			case err == nil:
+				if drift := consumerConfigDrift(consumer.CachedInfo().Config, consumerCfg); len(drift) != 0 {
+					log.Warn().Strs("drift", drift).Msgf("consumer %s on stream %s config differs from spec, updating", consumerSpec.Name, spec.Name)
+				}
+			case errors.Is(err, jetstream.ErrConsumerNotFound):
+				log.Info().Msgf("consumer %s on stream %s not found, creating", consumerSpec.Name, spec.Name)
+			default:
+				return errors.Wrapf(err, "failed to get consumer %s on stream %s", consumerSpec.Name, spec.Name)
+			}
+
+			if _, err := stream.CreateOrUpdateConsumer(ctx, consumerCfg); err != nil {
+				return errors.Wrapf(err, "failed to create or update consumer %s on stream %s", consumerSpec.Name, spec.Name)
+			}
+		}
+		log.Info().Msgf("stream %s provisioned", spec.Name)
+	}
+	return nil
+}
+
+func streamConfigDrift(live jetstream.StreamConfig, spec jetstream.StreamConfig) []string {
+	var drift []string
+	if !slices.Equal(live.Subjects, spec.Subjects) {
+		drift = append(drift, fmt.Sprintf("subjects: %v -> %v", live.Subjects, spec.Subjects))
+	}
+	if live.Retention != spec.Retention {
+		drift = append(drift, fmt.Sprintf("retention: %s -> %s", live.Retention, spec.Retention))
+	}
+	if live.Storage != spec.Storage {
+		drift = append(drift, fmt.Sprintf("storage: %s -> %s", live.Storage, spec.Storage))
+	}
+	if live.MaxAge != spec.MaxAge {
+		drift = append(drift, fmt.Sprintf("maxAge: %s -> %s", live.MaxAge, spec.MaxAge))
+	}
+	if live.Replicas != spec.Replicas {
+		drift = append(drift, fmt.Sprintf("replicas: %d -> %d", live.Replicas, spec.Replicas))
+	}
+	if spec.Duplicates != 0 && live.Duplicates != spec.Duplicates {
+		drift = append(drift, fmt.Sprintf("duplicatesWindow: %s -> %s", live.Duplicates, spec.Duplicates))
+	}
+	return drift
+}
+
+func consumerConfigDrift(live jetstream.ConsumerConfig, spec jetstream.ConsumerConfig) []string {
+	var drift []string
+	if live.DeliverPolicy != spec.DeliverPolicy {
+		drift = append(drift, fmt.Sprintf("deliverPolicy: %s -> %s", live.DeliverPolicy, spec.DeliverPolicy))
+	}
+	if spec.AckWait != 0 && live.AckWait != spec.AckWait {
+		drift = append(drift, fmt.Sprintf("ackWait: %s -> %s", live.AckWait, spec.AckWait))
+	}
+	if spec.MaxDeliver != 0 && live.MaxDeliver != spec.MaxDeliver {
+		drift = append(drift, fmt.Sprintf("maxDeliver: %d -> %d", live.MaxDeliver, spec.MaxDeliver))
+	}
+	if spec.MaxAckPending != 0 && live.MaxAckPending != spec.MaxAckPending {
+		drift = append(drift, fmt.Sprintf("maxAckPending: %d -> %d", live.MaxAckPending, spec.MaxAckPending))
+	}
+	if live.FilterSubject != spec.FilterSubject {
+		drift = append(drift, fmt.Sprintf("filterSubject: %s -> %s", live.FilterSubject, spec.FilterSubject))
+	}
+	if !slices.Equal(live.FilterSubjects, spec.FilterSubjects) {
+		drift = append(drift, fmt.Sprintf("filterSubjects: %v -> %v", live.FilterSubjects, spec.FilterSubjects))
+	}
+	return drift
+}
@@ -0,0 +1,128 @@
+package natsClient
+
+import (
+	"context"
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/balobas/sport_city_common/tracer"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type natsJsOptionPublishAsyncMaxPending struct {
+	maxPending int
+	stallWait  time.Duration
+}
+
+func (np *natsJsOptionPublishAsyncMaxPending) Apply(opt *NatsClientJsOpts) {
+	opt.publishAsyncMaxPending = np.maxPending
+	opt.publishAsyncStallWait = np.stallWait
+}
+
+/*
+WithPublishAsyncMaxPending
+Ограничивает количество неподтвержденных асинхронных публикаций.
+Если лимит достигнут, PublishAsync ждет освобождения места не дольше stallWait
+и возвращает ошибку (stallWait = 0 - значение по умолчанию nats, 200ms)
+*/
+func WithPublishAsyncMaxPending(maxPending int, stallWait time.Duration) NatsClientJetStreamOption {
+	return &natsJsOptionPublishAsyncMaxPending{
+		maxPending: maxPending,
+		stallWait:  stallWait,
+	}
+}
+
+func (opts NatsClientJsOpts) jetStreamOpts() []jetstream.JetStreamOpt {
+	var jsOpts []jetstream.JetStreamOpt
+	if opts.publishAsyncMaxPending > 0 {
+		jsOpts = append(jsOpts, jetstream.WithPublishAsyncMaxPending(opts.publishAsyncMaxPending))
+	}
+	return jsOpts
+}
+
+// PublishFuture подтверждение асинхронной публикации
+type PublishFuture struct {
+	future jetstream.PubAckFuture
+}
+
+// Wait ждет подтверждения от брокера или завершения ctx
+func (f *PublishFuture) Wait(ctx context.Context) (mqClient.PublishAck, error) {
+	select {
+	case ack := <-f.future.Ok():
+		return toPublishAck(ack), nil
+	case err := <-f.future.Err():
+		return mqClient.PublishAck{}, errors.WithStack(err)
+	case <-ctx.Done():
+		return mqClient.PublishAck{}, errors.Wrapf(ctx.Err(), "waiting for publish ack on %s", f.future.Msg().Subject)
+	}
+}
+
+/*
+PublishAsync
+Отправляет сообщение без ожидания подтверждения, подтверждение получается через PublishFuture.Wait.
+Количество неподтвержденных сообщений ограничивается WithPublishAsyncMaxPending
+*/
+func (nc *NatsClientJetStream) PublishAsync(ctx context.Context, pubMsg mqClient.PublishMsg) (*PublishFuture, error) {
+	log := logger.From(ctx).With().Fields(map[string]interface{}{
+		"layer":     "mqPublisher",
+		"component": "NatsClientJetStream",
+		"method":    "PublishAsync",
+	}).Logger()
+	log.Debug().Fields(map[string]interface{}{
+		"subject": pubMsg.Subject,
+		"msgId":   pubMsg.MsgId,
+		"data":    string(pubMsg.Data),
+	}).Send()
+
+	msg, pubOpts := newJsPublishMsg(pubMsg)
+	if nc.opts.publishAsyncStallWait > 0 {
+		pubOpts = append(pubOpts, jetstream.WithStallWait(nc.opts.publishAsyncStallWait))
+	}
+
+	var span trace.Span = trace.SpanFromContext(ctx)
+	if nc.opts.withTrace {
+		if !span.SpanContext().IsValid() {
+			ctx = ctxWithTraceIdFromPayload(ctx, log, pubMsg.Data)
+		}
+		ctx, span = tracer.FromCtx(ctx).Start(ctx, "NatsClientJetStream.PublishAsync", trace.WithSpanKind(trace.SpanKindProducer))
+		defer span.End()
+
+		injectTraceIntoHeaders(ctx, msg.Header)
+	}
+
+	future, err := nc.js.PublishMsgAsync(msg, pubOpts...)
+	if err != nil {
+		span.RecordError(err, trace.WithAttributes(
+			attribute.String("message", "failed to publish message"),
+		))
+		log.Debug().Err(err).Msg("failed to publish message async")
+		return nil, errors.WithStack(err)
+	}
+	return &PublishFuture{future: future}, nil
+}
+
+/*
+PublishBatch
+Отправляет все сообщения асинхронно и ждет подтверждения каждого.
+Результаты возвращаются в порядке msgs, сообщения без подтверждения имеют Err != nil
+*/
+func (nc *NatsClientJetStream) PublishBatch(ctx context.Context, msgs []mqClient.PublishMsg) []mqClient.PublishResult {
+	results := make([]mqClient.PublishResult, len(msgs))
+	futures := make([]*PublishFuture, len(msgs))
+
+	for i, msg := range msgs {
+		futures[i], results[i].Err = nc.PublishAsync(ctx, msg)
+	}
+
+	for i, future := range futures {
+		if future == nil {
+			continue
+		}
+		results[i].Ack, results[i].Err = future.Wait(ctx)
+	}
+	return results
+}
@@ -0,0 +1,165 @@
+package natsClient
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/balobas/sport_city_common/tracer"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	RequestHeaderDeadline = "Mq-Deadline"
+	ReplyHeaderError      = "Mq-Error"
+)
+
+var ErrNoResponders = errors.New("no responders for request")
+
+// ReplyError ошибка, которую вернул обработчик запроса на стороне отвечающего сервиса
+type ReplyError struct {
+	Subject string
+	Msg     string
+}
+
+func (e *ReplyError) Error() string {
+	return "reply error from " + e.Subject + ": " + e.Msg
+}
+
+func (nc *NatsClientPubSub) Request(ctx context.Context, subj string, data []byte) ([]byte, error) {
+	return request(ctx, nc.conn, nc.opts.withTrace, subj, data)
+}
+
+func (nc *NatsClientPubSub) Reply(ctx context.Context, queueGroup string, handlers map[string]mqClient.MqReplyHandler) error {
+	if len(queueGroup) == 0 {
+		queueGroup = nc.cfg.ServiceName()
+	}
+	return subscribeReplyHandlers(ctx, nc.conn, nc.opts.withTrace, queueGroup, handlers)
+}
+
+func (nc *NatsClientJetStream) Request(ctx context.Context, subj string, data []byte) ([]byte, error) {
+	return request(ctx, nc.conn, nc.opts.withTrace, subj, data)
+}
+
+func (nc *NatsClientJetStream) Reply(ctx context.Context, queueGroup string, handlers map[string]mqClient.MqReplyHandler) error {
+	if len(queueGroup) == 0 {
+		queueGroup = nc.cfg.ServiceName()
+	}
+	return subscribeReplyHandlers(ctx, nc.conn, nc.opts.withTrace, queueGroup, handlers)
+}
+
+func request(ctx context.Context, conn *nats.Conn, withTrace bool, subj string, data []byte) ([]byte, error) {
+	log := logger.From(ctx).With().Fields(map[string]interface{}{
+		"layer":   "mqRequester",
+		"method":  "Request",
+		"subject": subj,
+	}).Logger()
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, nats.DefaultTimeout)
+		defer cancel()
+	}
+	deadline, _ := ctx.Deadline()
+
+	msg := &nats.Msg{
+		Subject: subj,
+		Data:    data,
+		Header:  nats.Header{},
+	}
+	msg.Header.Set(RequestHeaderDeadline, strconv.FormatInt(deadline.UnixNano(), 10))
+
+	span := trace.SpanFromContext(ctx)
+	if withTrace {
+		ctx, span = tracer.FromCtx(ctx).Start(ctx, "Request "+subj, trace.WithSpanKind(trace.SpanKindClient))
+		defer span.End()
+	}
+	injectTraceIntoHeaders(ctx, msg.Header)
+
+	resp, err := conn.RequestMsgWithContext(ctx, msg)
+	if err != nil {
+		if errors.Is(err, nats.ErrNoResponders) {
+			err = ErrNoResponders
+		}
+		span.RecordError(err)
+		log.Debug().Err(err).Msg("request failed")
+		return nil, errors.WithStack(err)
+	}
+
+	if replyErr := resp.Header.Get(ReplyHeaderError); len(replyErr) != 0 {
+		err := &ReplyError{Subject: subj, Msg: replyErr}
+		span.RecordError(err)
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+func subscribeReplyHandlers(
+	ctx context.Context,
+	conn *nats.Conn,
+	withTrace bool,
+	queueGroup string,
+	handlers map[string]mqClient.MqReplyHandler,
+) error {
+	log := logger.From(ctx)
+
+	for subject, handler := range handlers {
+		_, err := conn.QueueSubscribe(subject, queueGroup, convertToNatsReplyHandler(ctx, withTrace, handler))
+		if err != nil {
+			log.Debug().Msgf("failed to subscribe reply handler on subject %s", subject)
+			return errors.WithStack(err)
+		}
+		log.Info().Msgf("successfully subscribed reply handler on %s (queue group %s)", subject, queueGroup)
+	}
+	return nil
+}
+
+func convertToNatsReplyHandler(ctx context.Context, withTrace bool, handler mqClient.MqReplyHandler) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		log := logger.From(ctx).With().Fields(map[string]interface{}{
+			"layer":     "handlers",
+			"layerType": "mqReply",
+			"subject":   msg.Subject,
+		}).Logger()
+
+		reqCtx := mqClient.ContextWithMeta(ctx, natsMsgMeta(msg))
+		if deadlineStr := msg.Header.Get(RequestHeaderDeadline); len(deadlineStr) != 0 {
+			if deadlineNano, err := strconv.ParseInt(deadlineStr, 10, 64); err == nil {
+				var cancel context.CancelFunc
+				reqCtx, cancel = context.WithDeadline(reqCtx, time.Unix(0, deadlineNano))
+				defer cancel()
+			}
+		}
+
+		reqCtx = extractTraceFromHeaders(reqCtx, msg.Header)
+		span := trace.SpanFromContext(reqCtx)
+		if withTrace {
+			reqCtx, span = tracer.FromCtx(reqCtx).Start(reqCtx, "Reply "+msg.Subject, trace.WithSpanKind(trace.SpanKindServer))
+			defer span.End()
+		}
+
+		resp := &nats.Msg{Header: nats.Header{}}
+
+		data, err := handler(reqCtx, msg.Data)
+		if err != nil {
+			span.RecordError(err)
+			log.Error().Err(err).Msgf("failed to handle request %s", msg.Data)
+			resp.Header.Set(ReplyHeaderError, err.Error())
+		} else {
+			resp.Data = data
+		}
+
+		if reqCtx.Err() != nil {
+			log.Warn().Msg("request deadline exceeded, reply skipped")
+			return
+		}
+
+		if err := msg.RespondMsg(resp); err != nil {
+			log.Error().Err(err).Msg("failed to respond")
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package natsClient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrStreamNotFound   = jetstream.ErrStreamNotFound
+	ErrConsumerNotFound = jetstream.ErrConsumerNotFound
+)
+
+var defaultResubscribeBackoff = ExponentialBackoff{
+	Initial:    1 * time.Second,
+	Max:        1 * time.Minute,
+	Multiplier: 2,
+	Jitter:     0.2,
+}
+
+// signal будит всех ожидающих при каждом Notify
+type signal struct {
+	mx sync.Mutex
+	ch chan struct{}
+}
+
+func newSignal() *signal {
+	return &signal{ch: make(chan struct{})}
+}
+
+func (s *signal) Wait() <-chan struct{} {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.ch
+}
+
+func (s *signal) Notify() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	close(s.ch)
+	s.ch = make(chan struct{})
+}
+
+type natsJsOptionResubscribeBackoff struct {
+	policy BackoffPolicy
+}
+
+func (nr *natsJsOptionResubscribeBackoff) Apply(opt *NatsClientJsOpts) {
+	opt.resubscribeBackoff = nr.policy
+}
+
+// WithResubscribeBackoff задержка между попытками инициализировать консумер, который не удалось запустить
+func WithResubscribeBackoff(policy BackoffPolicy) NatsClientJetStreamOption {
+	return &natsJsOptionResubscribeBackoff{policy: policy}
+}
+
+func (nc *NatsClientJetStream) subscribeConsumer(
+	ctx context.Context,
+	streamName string,
+	consumerName string,
+	handler mqClient.MqMsgHandler,
+) error {
+	consumer, err := nc.getConsumer(ctx, streamName, consumerName)
+	if err != nil {
+		return err
+	}
+
+	if err := nc.consume(ctx, consumer, streamName, consumerName, handler); err != nil {
+		return errors.Wrapf(err, "failed to init consumer %s on stream %s", consumerName, streamName)
+	}
+	return nil
+}
+
+func (nc *NatsClientJetStream) getConsumer(ctx context.Context, streamName string, consumerName string) (jetstream.Consumer, error) {
+	stream, err := nc.js.Stream(ctx, streamName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get stream %s", streamName)
+	}
+
+	consumer, err := stream.Consumer(ctx, consumerName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get consumer %s on stream %s", consumerName, streamName)
+	}
+	return consumer, nil
+}
+
+/*
+superviseResubscribe
+Пытается запустить консумер с экспоненциальной задержкой (или сразу после переподключения к nats),
+пока не получится, не закончится ctx или не будет вызван Close.
+На один консумер запускается не больше одной горутины
+*/
+func (nc *NatsClientJetStream) superviseResubscribe(
+	ctx context.Context,
+	streamName string,
+	consumerName string,
+	subscribe func() error,
+	subErr error,
+) {
+	key := consumerKey{stream: streamName, consumer: consumerName}
+
+	nc.mx.Lock()
+	if nc.resubscribing == nil {
+		nc.resubscribing = map[consumerKey]struct{}{}
+	}
+	if _, ok := nc.resubscribing[key]; ok {
+		nc.mx.Unlock()
+		return
+	}
+	nc.resubscribing[key] = struct{}{}
+	nc.mx.Unlock()
+
+	nc.setConsumerState(streamName, consumerName, ConsumerStateRetrying, subErr)
+
+	backoff := nc.opts.resubscribeBackoff
+	if backoff == nil {
+		backoff = defaultResubscribeBackoff
+	}
+
+	log := logger.From(ctx).With().Fields(map[string]interface{}{
+		"component": "NatsClientJetStream",
+		"stream":    streamName,
+		"consumer":  consumerName,
+	}).Logger()
+
+	nc.wg.Add(1)
+	go func() {
+		defer nc.wg.Done()
+		defer func() {
+			nc.mx.Lock()
+			delete(nc.resubscribing, key)
+			nc.mx.Unlock()
+		}()
+
+		for attempt := uint64(1); ; attempt++ {
+			timer := time.NewTimer(backoff.Delay(attempt))
+
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				log.Info().Msg("stop attempts to init failed consumer, ctx done")
+				return
+			case <-nc.stop:
+				timer.Stop()
+				log.Info().Msg("stop attempts to init failed consumer, client closed")
+				return
+			case <-nc.reconnected.Wait():
+				timer.Stop()
+			case <-timer.C:
+			}
+
+			err := subscribe()
+			if err == nil {
+				log.Info().Msgf("successfully init consumer after %d attempts", attempt)
+				return
+			}
+
+			switch {
+			case errors.Is(err, ErrStreamNotFound):
+				log.Warn().Err(err).Msg("stream not found, waiting for it to be created")
+			case errors.Is(err, ErrConsumerNotFound):
+				log.Warn().Err(err).Msg("consumer not found, waiting for it to be created")
+			default:
+				log.Warn().Err(err).Msg("failed to init consumer")
+			}
+			nc.setConsumerState(streamName, consumerName, ConsumerStateRetrying, err)
+		}
+	}()
+}
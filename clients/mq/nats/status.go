@@ -0,0 +1,138 @@
+package natsClient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type ConsumerState string
+
+const (
+	ConsumerStateActive   ConsumerState = "active"
+	ConsumerStateFailed   ConsumerState = "failed"
+	ConsumerStateRetrying ConsumerState = "retrying"
+)
+
+type ConsumerStatus struct {
+	Stream         string
+	Consumer       string
+	State          ConsumerState
+	LastError      string
+	NumPending     uint64
+	NumAckPending  int
+	NumRedelivered int
+	UpdatedAt      time.Time
+}
+
+type consumerStatus struct {
+	state     ConsumerState
+	lastErr   error
+	updatedAt time.Time
+}
+
+func (nc *NatsClientJetStream) setConsumerState(streamName string, consumerName string, state ConsumerState, err error) {
+	nc.mx.Lock()
+	defer nc.mx.Unlock()
+
+	if nc.statuses == nil {
+		nc.statuses = map[consumerKey]*consumerStatus{}
+	}
+
+	key := consumerKey{stream: streamName, consumer: consumerName}
+	status, ok := nc.statuses[key]
+	if !ok {
+		status = &consumerStatus{}
+		nc.statuses[key] = status
+	}
+
+	status.state = state
+	status.updatedAt = time.Now().UTC()
+	if err != nil {
+		status.lastErr = err
+	}
+}
+
+/*
+Status
+Состояние всех зарегистрированных консумеров. Для активных консумеров
+запрашивает у сервера количество ожидающих, неподтвержденных и передоставленных сообщений
+*/
+func (nc *NatsClientJetStream) Status(ctx context.Context) []ConsumerStatus {
+	nc.mx.Lock()
+	res := make([]ConsumerStatus, 0, len(nc.statuses))
+	for key, status := range nc.statuses {
+		s := ConsumerStatus{
+			Stream:    key.stream,
+			Consumer:  key.consumer,
+			State:     status.state,
+			UpdatedAt: status.updatedAt,
+		}
+		if status.lastErr != nil {
+			s.LastError = status.lastErr.Error()
+		}
+		res = append(res, s)
+	}
+
+	active := make(map[consumerKey]*jsConsumer, len(nc.consumers))
+	for _, c := range nc.consumers {
+		active[consumerKey{stream: c.stream, consumer: c.name}] = c
+	}
+	nc.mx.Unlock()
+
+	for i := range res {
+		c, ok := active[consumerKey{stream: res[i].Stream, consumer: res[i].Consumer}]
+		if !ok || c.consumer == nil {
+			continue
+		}
+
+		info, err := c.consumer.Info(ctx)
+		if err != nil {
+			res[i].LastError = err.Error()
+			continue
+		}
+		res[i].NumPending = info.NumPending
+		res[i].NumAckPending = info.NumAckPending
+		res[i].NumRedelivered = info.NumRedelivered
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Stream != res[j].Stream {
+			return res[i].Stream < res[j].Stream
+		}
+		return res[i].Consumer < res[j].Consumer
+	})
+	return res
+}
+
+// Ready возвращает ошибку, если соединение не установлено или не все консумеры запущены
+func (nc *NatsClientJetStream) Ready(ctx context.Context) error {
+	if !nc.conn.IsConnected() {
+		return errors.Errorf("nats not connected: %s", nc.conn.Status())
+	}
+
+	nc.mx.Lock()
+	defer nc.mx.Unlock()
+
+	var notReady []string
+	for key, status := range nc.statuses {
+		if status.state == ConsumerStateActive {
+			continue
+		}
+		msg := fmt.Sprintf("%s/%s: %s", key.stream, key.consumer, status.state)
+		if status.lastErr != nil {
+			msg += " (" + status.lastErr.Error() + ")"
+		}
+		notReady = append(notReady, msg)
+	}
+
+	if len(notReady) != 0 {
+		sort.Strings(notReady)
+		return errors.Errorf("consumers not ready: %s", strings.Join(notReady, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package natsClient
+
+import (
+	"context"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/balobas/sport_city_common/tracer"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+)
+
+// natsHeaderCarrier адаптер nats.Header к propagation.TextMapCarrier
+type natsHeaderCarrier nats.Header
+
+func (c natsHeaderCarrier) Get(key string) string {
+	return nats.Header(c).Get(key)
+}
+
+func (c natsHeaderCarrier) Set(key string, value string) {
+	nats.Header(c).Set(key, value)
+}
+
+func (c natsHeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func injectTraceIntoHeaders(ctx context.Context, header nats.Header) {
+	tracer.Propagator().Inject(ctx, natsHeaderCarrier(header))
+}
+
+func extractTraceFromHeaders(ctx context.Context, header nats.Header) context.Context {
+	return tracer.Propagator().Extract(ctx, natsHeaderCarrier(header))
+}
+
+// ctxWithTraceIdFromPayload traceId из payload для сообщений, опубликованных без трейса в ctx
+func ctxWithTraceIdFromPayload(ctx context.Context, log zerolog.Logger, data []byte) context.Context {
+	ctx, err := mqClient.ContextWithPayloadTraceId(ctx, data)
+	if err != nil {
+		log.Warn().Str("error", err.Error()).Msg("failed to get traceID from message")
+	}
+	return ctx
+}
@@ -0,0 +1,193 @@
+package natsClient
+
+import (
+	"context"
+	"sync"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+)
+
+const defaultMaxInFlight = 1
+
+// consumeStopper jetstream.ConsumeContext или цикл batch консумера
+type consumeStopper interface {
+	Stop()
+	Closed() <-chan struct{}
+}
+
+// jsConsumer запущенный консумер и пул воркеров, обрабатывающих его сообщения (у batch консумера пула нет)
+type jsConsumer struct {
+	stream     string
+	name       string
+	consumer   jetstream.Consumer
+	consumeCtx consumeStopper
+	pool       *consumerWorkerPool
+}
+
+type consumerWorkerPool struct {
+	msgs chan jetstream.Msg
+	wg   sync.WaitGroup
+}
+
+func newConsumerWorkerPool(size int, handler jetstream.MessageHandler) *consumerWorkerPool {
+	if size < 1 {
+		size = defaultMaxInFlight
+	}
+
+	p := &consumerWorkerPool{
+		msgs: make(chan jetstream.Msg),
+	}
+
+	p.wg.Add(size)
+	for i := 0; i < size; i++ {
+		go func() {
+			defer p.wg.Done()
+			for msg := range p.msgs {
+				handler(msg)
+			}
+		}()
+	}
+	return p
+}
+
+// handle блокируется, пока все воркеры заняты
+func (p *consumerWorkerPool) handle(msg jetstream.Msg) {
+	p.msgs <- msg
+}
+
+// shutdown закрывает пул и ждет завершения воркеров. Вызывается только после того, как consume перестал вызывать handle
+func (p *consumerWorkerPool) shutdown() {
+	close(p.msgs)
+	p.wg.Wait()
+}
+
+// stop то же, что shutdown, но ждет не дольше ctx. Воркеры завершатся и после ctx.Done
+func (p *consumerWorkerPool) stop(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		p.shutdown()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "in-flight handlers not finished")
+	}
+}
+
+type natsJsOptionMaxInFlight struct {
+	key         consumerKey
+	maxInFlight int
+}
+
+func (nm *natsJsOptionMaxInFlight) Apply(opt *NatsClientJsOpts) {
+	if opt.maxInFlight == nil {
+		opt.maxInFlight = map[consumerKey]int{}
+	}
+	opt.maxInFlight[nm.key] = nm.maxInFlight
+}
+
+// WithMaxInFlight максимальное количество сообщений, обрабатываемых консумером одновременно
+func WithMaxInFlight(streamName string, consumerName string, maxInFlight int) NatsClientJetStreamOption {
+	return &natsJsOptionMaxInFlight{
+		key:         consumerKey{stream: streamName, consumer: consumerName},
+		maxInFlight: maxInFlight,
+	}
+}
+
+type natsJsOptionDefaultMaxInFlight int
+
+func (nm natsJsOptionDefaultMaxInFlight) Apply(opt *NatsClientJsOpts) {
+	opt.defaultMaxInFlight = int(nm)
+}
+
+// WithDefaultMaxInFlight то же, что WithMaxInFlight, для всех консумеров без явной настройки
+func WithDefaultMaxInFlight(maxInFlight int) NatsClientJetStreamOption {
+	return natsJsOptionDefaultMaxInFlight(maxInFlight)
+}
+
+func (nc *NatsClientJetStream) maxInFlight(streamName string, consumerName string) int {
+	if maxInFlight, ok := nc.opts.maxInFlight[consumerKey{stream: streamName, consumer: consumerName}]; ok && maxInFlight > 0 {
+		return maxInFlight
+	}
+	if nc.opts.defaultMaxInFlight > 0 {
+		return nc.opts.defaultMaxInFlight
+	}
+	return defaultMaxInFlight
+}
+
+func (nc *NatsClientJetStream) consume(
+	ctx context.Context,
+	consumer jetstream.Consumer,
+	streamName string,
+	consumerName string,
+	handler mqClient.MqMsgHandler,
+) error {
+	maxInFlight := nc.maxInFlight(streamName, consumerName)
+	pool := newConsumerWorkerPool(maxInFlight, nc.convertToNatsJsMsgHandler(ctx, streamName, consumerName, handler))
+
+	consumeCtx, err := consumer.Consume(pool.handle)
+	if err != nil {
+		pool.stop(ctx)
+		return errors.WithStack(err)
+	}
+
+	nc.mx.Lock()
+	nc.consumers = append(nc.consumers, &jsConsumer{
+		stream:     streamName,
+		name:       consumerName,
+		consumer:   consumer,
+		consumeCtx: consumeCtx,
+		pool:       pool,
+	})
+	nc.mx.Unlock()
+
+	nc.setConsumerState(streamName, consumerName, ConsumerStateActive, nil)
+	return nil
+}
+
+/*
+stopConsumers
+Останавливает получение новых сообщений и ждет завершения уже запущенных хендлеров (или ctx.Done).
+Необработанные сообщения из буфера будут передоставлены сервером после ack wait
+*/
+func (nc *NatsClientJetStream) stopConsumers(ctx context.Context) error {
+	nc.mx.Lock()
+	consumers := nc.consumers
+	nc.consumers = nil
+	nc.mx.Unlock()
+
+	for _, c := range consumers {
+		c.consumeCtx.Stop()
+	}
+
+	// пулы закрываются в фоне и после ctx.Done, чтобы воркеры не остались висеть
+	var wg sync.WaitGroup
+	for _, c := range consumers {
+		wg.Add(1)
+		go func(c *jsConsumer) {
+			defer wg.Done()
+			<-c.consumeCtx.Closed()
+			if c.pool != nil {
+				c.pool.shutdown()
+			}
+		}(c)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "consumers not stopped")
+	}
+}
@@ -0,0 +1,271 @@
+package mqPostgres
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	clientDB "github.com/balobas/sport_city_common/clients/database"
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	mqMiddleware "github.com/balobas/sport_city_common/clients/mq/middleware"
+	"github.com/balobas/sport_city_common/logger"
+	notifyPayloadRepository "github.com/balobas/sport_city_common/repository/notify_payload"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// maxNotifyPayloadSize лимит pg_notify 8000 байт, с запасом
+	maxNotifyPayloadSize = 7900
+
+	defaultHandlerWorkers = 8
+
+	// minPayloadRetention очистка запускается раз в payloadRetention/2, меньшие значения не имеют смысла
+	minPayloadRetention = time.Second
+)
+
+// notification тело pg_notify. Большие сообщения передаются ссылкой на строку mq_notify_payloads (Ref)
+type notification struct {
+	Subject string              `json:"subject"`
+	Data    []byte              `json:"data,omitempty"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	Ref     *uuid.UUID          `json:"ref,omitempty"`
+}
+
+/*
+Client
+Легковесный pub/sub поверх postgres LISTEN/NOTIFY для сервисов без брокера.
+  - сабжект - канал notify, все инстансы, подписанные на канал, получают все сообщения
+  - сообщения не хранятся: подписчик, который был отключен, их пропустит, ack и повторной доставки нет
+  - Publish с транзакцией в ctx (ClientDB.BeginTxWithContext) отправляет уведомление только при коммите
+  - сообщения больше 8000 байт сохраняются в mq_notify_payloads (notifyPayloadRepository),
+    в уведомлении передается ссылка
+*/
+type Client struct {
+	db       clientDB.ClientDB
+	payloads *notifyPayloadRepository.NotifyPayloadRepository
+	opts     options
+
+	listener *listener
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+type options struct {
+	reconnectDelay   time.Duration
+	payloadRetention time.Duration
+	handlerWorkers   int
+	middlewares      []mqClient.MqMiddleware
+}
+
+type Option func(opts *options)
+
+// WithReconnectDelay задержка перед переподключением слушающего соединения
+func WithReconnectDelay(delay time.Duration) Option {
+	return func(opts *options) {
+		opts.reconnectDelay = delay
+	}
+}
+
+// WithPayloadRetention сколько хранятся payload больших сообщений, не меньше секунды
+func WithPayloadRetention(retention time.Duration) Option {
+	return func(opts *options) {
+		opts.payloadRetention = retention
+	}
+}
+
+// WithHandlerWorkers сколько уведомлений обрабатывается параллельно, 1 - строго по порядку
+func WithHandlerWorkers(workers int) Option {
+	return func(opts *options) {
+		opts.handlerWorkers = workers
+	}
+}
+
+// WithMiddlewares middlewares для всех подписок клиента
+func WithMiddlewares(middlewares ...mqClient.MqMiddleware) Option {
+	return func(opts *options) {
+		opts.middlewares = append(opts.middlewares, middlewares...)
+	}
+}
+
+func New(ctx context.Context, db clientDB.ClientDB, opts ...Option) (mqClient.MqClient, error) {
+	c := &Client{
+		db:       db,
+		payloads: notifyPayloadRepository.New(db),
+		opts: options{
+			reconnectDelay:   time.Second,
+			payloadRetention: time.Hour,
+			handlerWorkers:   defaultHandlerWorkers,
+		},
+		stop: make(chan struct{}),
+	}
+	for _, apply := range opts {
+		apply(&c.opts)
+	}
+	if c.opts.handlerWorkers < 1 {
+		c.opts.handlerWorkers = 1
+	}
+	if c.opts.payloadRetention < minPayloadRetention {
+		return nil, errors.Errorf("payload retention must be at least %s, got %s", minPayloadRetention, c.opts.payloadRetention)
+	}
+
+	c.listener = newListener(c)
+
+	for i := 0; i < c.opts.handlerWorkers; i++ {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.listener.handlerWorker(ctx)
+		}()
+	}
+
+	c.wg.Add(2)
+	go func() {
+		defer c.wg.Done()
+		c.listener.run(ctx)
+	}()
+	go func() {
+		defer c.wg.Done()
+		c.cleanupPayloads(ctx)
+	}()
+
+	return c, nil
+}
+
+func (c *Client) Publish(ctx context.Context, subj string, data []byte) error {
+	_, err := c.PublishMsg(ctx, mqClient.PublishMsg{
+		Subject: subj,
+		Data:    data,
+	})
+	return err
+}
+
+/*
+PublishMsg
+MsgId не поддерживается (нет дедупликации), PublishAck всегда пустой.
+Вне транзакции уведомление всегда отправляется через мастер, pg_notify на реплике не работает
+*/
+func (c *Client) PublishMsg(ctx context.Context, msg mqClient.PublishMsg) (mqClient.PublishAck, error) {
+	ctx = c.db.CtxWithMasterKey(ctx)
+
+	n := notification{
+		Subject: msg.Subject,
+		Data:    msg.Data,
+		Headers: msg.Headers,
+	}
+
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return mqClient.PublishAck{}, errors.WithStack(err)
+	}
+
+	if len(payload) > maxNotifyPayloadSize {
+		ref := uuid.NewV4()
+
+		headersBts, err := json.Marshal(msg.Headers)
+		if err != nil {
+			return mqClient.PublishAck{}, errors.WithStack(err)
+		}
+		if err := c.payloads.CreatePayload(ctx, ref, msg.Subject, msg.Data, headersBts); err != nil {
+			return mqClient.PublishAck{}, errors.Wrapf(err, "failed to store payload of message into %s", msg.Subject)
+		}
+
+		payload, err = json.Marshal(notification{Subject: msg.Subject, Ref: &ref})
+		if err != nil {
+			return mqClient.PublishAck{}, errors.WithStack(err)
+		}
+	}
+
+	if _, err := c.db.Exec(ctx, "select pg_notify($1, $2)", msg.Subject, string(payload)); err != nil {
+		return mqClient.PublishAck{}, errors.Wrapf(err, "failed to notify %s", msg.Subject)
+	}
+	return mqClient.PublishAck{}, nil
+}
+
+func (c *Client) PublishBatch(ctx context.Context, msgs []mqClient.PublishMsg) []mqClient.PublishResult {
+	results := make([]mqClient.PublishResult, len(msgs))
+	for i, msg := range msgs {
+		results[i].Ack, results[i].Err = c.PublishMsg(ctx, msg)
+	}
+	return results
+}
+
+/*
+Subscribe
+handlers: {"any key": {"subject": handler}}, ключ верхнего уровня не используется
+*/
+func (c *Client) Subscribe(ctx context.Context, handlers map[string]map[string]mqClient.MqMsgHandler) error {
+	for _, subjectHandlers := range handlers {
+		for subject, handler := range subjectHandlers {
+			c.listener.listen(ctx, subject, c.wrapHandler(handler), false)
+		}
+	}
+	return nil
+}
+
+/*
+SubscribeV2
+
+	streamConsumers: {
+		"subject": {
+			"consumerName": handler,
+		}
+	}
+
+Стрим - канал notify, consumerName используется только в Meta
+*/
+func (c *Client) SubscribeV2(ctx context.Context, streamsConsumers map[string]map[string]mqClient.MqMsgHandler) (subErr error) {
+	for subject, consumers := range streamsConsumers {
+		for _, handler := range consumers {
+			c.listener.listen(ctx, subject, c.wrapHandler(handler), false)
+		}
+	}
+	return nil
+}
+
+func (c *Client) wrapHandler(handler mqClient.MqMsgHandler) mqClient.MqMsgHandler {
+	return mqClient.Chain(handler, append([]mqClient.MqMiddleware{mqMiddleware.Recovery()}, c.opts.middlewares...)...)
+}
+
+func (c *Client) Close(ctx context.Context) error {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+		c.listener.wake()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "postgres mq listener not stopped")
+	}
+}
+
+func (c *Client) cleanupPayloads(ctx context.Context) {
+	log := logger.From(ctx).With().Str("component", "mqPostgres").Logger()
+
+	ticker := time.NewTicker(c.opts.payloadRetention / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			if err := c.payloads.DeleteCreatedBefore(ctx, time.Now().Add(-c.opts.payloadRetention)); err != nil {
+				log.Warn().Err(err).Msg("failed to delete old notify payloads")
+			}
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package mqPostgres
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+type channelSub struct {
+	ctx     context.Context
+	handler mqClient.MqMsgHandler
+	// inline обработчик вызывается в горутине listener, только для неблокирующих обработчиков (ответы Request)
+	inline bool
+}
+
+type dispatchJob struct {
+	ctx     context.Context
+	handler mqClient.MqMsgHandler
+	data    []byte
+}
+
+/*
+listener
+Держит выделенное соединение из GetMasterPool (Hijack, в пул не возвращается) и слушает
+на нем все каналы подписок. После потери соединения берет новое и заново выполняет LISTEN.
+Обработчики подписок выполняются пулом из WithHandlerWorkers горутин (handlerWorker),
+поэтому обработчик может вызывать Request: горутина listener продолжает выполнять LISTEN
+и доставлять ответы
+*/
+type listener struct {
+	c *Client
+
+	mx       sync.Mutex
+	subs     map[string]map[uint64]channelSub
+	ready    map[string]chan struct{}
+	nextId   uint64
+	wakeWait context.CancelFunc
+
+	jobs chan dispatchJob
+}
+
+func newListener(c *Client) *listener {
+	return &listener{
+		c:     c,
+		subs:  map[string]map[uint64]channelSub{},
+		ready: map[string]chan struct{}{},
+		jobs:  make(chan dispatchJob, c.opts.handlerWorkers),
+	}
+}
+
+/*
+listen
+Добавляет обработчик канала. Возвращает канал, который закрывается после выполнения LISTEN,
+и функцию отписки
+*/
+func (l *listener) listen(ctx context.Context, channel string, handler mqClient.MqMsgHandler, inline bool) (<-chan struct{}, func()) {
+	l.mx.Lock()
+	l.nextId++
+	id := l.nextId
+	if _, ok := l.subs[channel]; !ok {
+		l.subs[channel] = map[uint64]channelSub{}
+		l.ready[channel] = make(chan struct{})
+	}
+	l.subs[channel][id] = channelSub{ctx: ctx, handler: handler, inline: inline}
+	ready := l.ready[channel]
+	l.mx.Unlock()
+
+	l.wake()
+
+	return ready, func() {
+		l.mx.Lock()
+		delete(l.subs[channel], id)
+		if len(l.subs[channel]) == 0 {
+			delete(l.subs, channel)
+			delete(l.ready, channel)
+		}
+		l.mx.Unlock()
+
+		l.wake()
+	}
+}
+
+// wake прерывает ожидание уведомления, чтобы соединение выполнило LISTEN/UNLISTEN для изменившихся каналов
+func (l *listener) wake() {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if l.wakeWait != nil {
+		l.wakeWait()
+	}
+}
+
+func (l *listener) run(ctx context.Context) {
+	log := logger.From(ctx).With().Str("component", "mqPostgres").Logger()
+
+	for {
+		err := l.listenConn(ctx)
+		if l.stopped(ctx) {
+			return
+		}
+		log.Warn().Err(err).Msgf("postgres listener connection lost, reconnecting in %s", l.c.opts.reconnectDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-l.c.stop:
+			return
+		case <-time.After(l.c.opts.reconnectDelay):
+		}
+	}
+}
+
+func (l *listener) stopped(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	case <-l.c.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *listener) listenConn(ctx context.Context) error {
+	poolConn, err := l.c.db.GetMasterPool().Acquire(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to acquire listener connection")
+	}
+	conn := poolConn.Hijack()
+	defer conn.Close(context.Background())
+
+	listened := map[string]struct{}{}
+	for {
+		// wakeWait выставляется до syncChannels, чтобы не потерять подписки, добавленные во время синхронизации
+		waitCtx, cancel := context.WithCancel(ctx)
+		l.mx.Lock()
+		l.wakeWait = cancel
+		l.mx.Unlock()
+
+		if l.stopped(ctx) {
+			cancel()
+			return nil
+		}
+
+		if err := l.syncChannels(ctx, conn, listened); err != nil {
+			cancel()
+			return err
+		}
+
+		n, err := conn.WaitForNotification(waitCtx)
+
+		l.mx.Lock()
+		l.wakeWait = nil
+		l.mx.Unlock()
+		cancel()
+
+		if err != nil {
+			if conn.IsClosed() {
+				return errors.Wrap(err, "failed to wait for notification")
+			}
+			if l.stopped(ctx) {
+				return nil
+			}
+			// ожидание прервано через wake
+			continue
+		}
+
+		l.dispatch(ctx, n.Channel, n.Payload)
+	}
+}
+
+func (l *listener) syncChannels(ctx context.Context, conn *pgx.Conn, listened map[string]struct{}) error {
+	l.mx.Lock()
+	var toListen, toUnlisten []string
+	for channel := range l.subs {
+		if _, ok := listened[channel]; !ok {
+			toListen = append(toListen, channel)
+		}
+	}
+	for channel := range listened {
+		if _, ok := l.subs[channel]; !ok {
+			toUnlisten = append(toUnlisten, channel)
+		}
+	}
+	l.mx.Unlock()
+
+	for _, channel := range toListen {
+		if _, err := conn.Exec(ctx, "listen "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return errors.Wrapf(err, "failed to listen %s", channel)
+		}
+		listened[channel] = struct{}{}
+
+		l.mx.Lock()
+		if ready, ok := l.ready[channel]; ok {
+			select {
+			case <-ready:
+			default:
+				close(ready)
+			}
+		}
+		l.mx.Unlock()
+	}
+	for _, channel := range toUnlisten {
+		if _, err := conn.Exec(ctx, "unlisten "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return errors.Wrapf(err, "failed to unlisten %s", channel)
+		}
+		delete(listened, channel)
+	}
+	return nil
+}
+
+func (l *listener) dispatch(ctx context.Context, channel string, payload string) {
+	log := logger.From(ctx).With().Fields(map[string]interface{}{
+		"layer":     "handlers",
+		"layerType": "mqPostgres",
+		"subject":   channel,
+	}).Logger()
+
+	var n notification
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		log.Error().Err(err).Msg("failed to unmarshal notification")
+		return
+	}
+
+	if n.Ref != nil {
+		row, err := l.c.payloads.GetPayload(ctx, *n.Ref)
+		if err != nil {
+			log.Error().Err(err).Msgf("failed to get payload %s", n.Ref.String())
+			return
+		}
+		n.Data = row.Data
+		if len(row.Headers) != 0 {
+			if err := json.Unmarshal(row.Headers, &n.Headers); err != nil {
+				log.Error().Err(err).Msgf("failed to unmarshal headers of payload %s", n.Ref.String())
+				return
+			}
+		}
+	}
+
+	l.mx.Lock()
+	subs := make([]channelSub, 0, len(l.subs[channel]))
+	for _, sub := range l.subs[channel] {
+		subs = append(subs, sub)
+	}
+	l.mx.Unlock()
+
+	for _, sub := range subs {
+		if sub.ctx.Err() != nil {
+			continue
+		}
+
+		hdlrCtx := mqClient.ContextWithMeta(sub.ctx, mqClient.Meta{
+			Subject:      n.Subject,
+			Headers:      n.Headers,
+			Stream:       channel,
+			NumDelivered: 1,
+			Timestamp:    time.Now().UTC(),
+		})
+		if sub.inline {
+			if err := sub.handler(hdlrCtx, n.Data); err != nil {
+				log.Error().Err(err).Msg("failed to handle notification")
+			}
+			continue
+		}
+
+		select {
+		case l.jobs <- dispatchJob{ctx: hdlrCtx, handler: sub.handler, data: n.Data}:
+		case <-ctx.Done():
+			return
+		case <-l.c.stop:
+			return
+		}
+	}
+}
+
+func (l *listener) handlerWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-l.c.stop:
+			return
+		case job := <-l.jobs:
+			if err := job.handler(job.ctx, job.data); err != nil {
+				log := logger.From(job.ctx)
+				log.Error().Err(err).Str("component", "mqPostgres").Msg("failed to handle notification")
+			}
+		}
+	}
+}
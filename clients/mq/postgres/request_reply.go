@@ -0,0 +1,153 @@
+package mqPostgres
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	replyChannelPrefix    = "mq_reply_"
+	defaultRequestTimeout = 30 * time.Second
+)
+
+// ErrTxInCtx Request в транзакции: запрос был бы отправлен только при коммите
+var ErrTxInCtx = errors.New("request with transaction in ctx")
+
+type request struct {
+	ReplyTo  string `json:"replyTo"`
+	Deadline int64  `json:"deadline,omitempty"`
+	Data     []byte `json:"data"`
+}
+
+type reply struct {
+	Data  []byte `json:"data"`
+	Error string `json:"error,omitempty"`
+}
+
+// ReplyError ошибка, которую вернул обработчик запроса
+type ReplyError struct {
+	Subject string
+	Message string
+}
+
+func (e *ReplyError) Error() string {
+	return "reply handler error on " + e.Subject + ": " + e.Message
+}
+
+/*
+Request
+Запрос через NOTIFY, ответ приходит в отдельный канал. Без дедлайна в ctx ждет ответ defaultRequestTimeout.
+NOTIFY не сообщает о количестве слушателей, поэтому при отсутствии обработчика запрос завершается по таймауту.
+ctx с транзакцией не принимается (ErrTxInCtx)
+*/
+func (c *Client) Request(ctx context.Context, subj string, data []byte) ([]byte, error) {
+	if c.db.HasTxInCtx(ctx) {
+		return nil, errors.Wrap(ErrTxInCtx, subj)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultRequestTimeout)
+		defer cancel()
+	}
+	deadline, _ := ctx.Deadline()
+
+	replies := make(chan []byte, 1)
+	replyTo := replyChannelPrefix + uuid.NewV4().String()
+	listening, unlisten := c.listener.listen(ctx, replyTo, func(ctx context.Context, data []byte) error {
+		select {
+		case replies <- data:
+		default:
+		}
+		return nil
+	}, true)
+	defer unlisten()
+
+	select {
+	case <-listening:
+	case <-ctx.Done():
+		return nil, errors.Wrapf(ctx.Err(), "waiting for listen on reply channel for %s", subj)
+	}
+
+	reqBts, err := json.Marshal(request{
+		ReplyTo:  replyTo,
+		Deadline: deadline.UnixNano(),
+		Data:     data,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := c.Publish(ctx, subj, reqBts); err != nil {
+		return nil, errors.Wrapf(err, "failed to publish request to %s", subj)
+	}
+
+	select {
+	case respBts := <-replies:
+		var resp reply
+		if err := json.Unmarshal(respBts, &resp); err != nil {
+			return nil, errors.Wrapf(err, "failed to unmarshal reply from %s", subj)
+		}
+		if len(resp.Error) != 0 {
+			return nil, &ReplyError{Subject: subj, Message: resp.Error}
+		}
+		return resp.Data, nil
+	case <-ctx.Done():
+		return nil, errors.Wrapf(ctx.Err(), "waiting for reply from %s", subj)
+	}
+}
+
+/*
+Reply
+Подписывает обработчики запросов на каналы. Queue groups не поддерживаются: запрос получают
+все инстансы, в ответ запрашивающему уходит первый ответ, queueGroup игнорируется
+*/
+func (c *Client) Reply(ctx context.Context, queueGroup string, handlers map[string]mqClient.MqReplyHandler) error {
+	for subject, handler := range handlers {
+		c.listener.listen(ctx, subject, func(ctx context.Context, data []byte) error {
+			return c.handleRequest(ctx, subject, data, handler)
+		}, false)
+	}
+	return nil
+}
+
+func (c *Client) handleRequest(ctx context.Context, subject string, data []byte, handler mqClient.MqReplyHandler) error {
+	log := logger.From(ctx).With().Fields(map[string]interface{}{
+		"layer":     "handlers",
+		"layerType": "mqReply",
+		"subject":   subject,
+	}).Logger()
+
+	var req request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return errors.Wrap(err, "failed to unmarshal request")
+	}
+
+	reqCtx := ctx
+	if req.Deadline != 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithDeadline(reqCtx, time.Unix(0, req.Deadline))
+		defer cancel()
+	}
+
+	var resp reply
+	respData, err := handler(reqCtx, req.Data)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to handle request %s", req.Data)
+		resp.Error = err.Error()
+	} else {
+		resp.Data = respData
+	}
+
+	respBts, err := json.Marshal(resp)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal reply")
+	}
+	return errors.Wrap(c.Publish(ctx, req.ReplyTo, respBts), "failed to publish reply")
+}
@@ -0,0 +1,82 @@
+package mqClient
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// HeaderPartitionKey ключ партиции сообщения, сообщения с одним ключом публикуются из outbox по порядку
+const HeaderPartitionKey = "Mq-Partition-Key"
+
+type PublishMsg struct {
+	Subject string
+	Data    []byte
+	Headers map[string][]string
+	// MsgId идентификатор для дедупликации на стороне брокера (Nats-Msg-Id)
+	MsgId string
+}
+
+type PublishAck struct {
+	Stream   string
+	Sequence uint64
+	// Duplicate сообщение с таким MsgId уже было принято брокером в окне дедупликации
+	Duplicate bool
+}
+
+// PublishResult результат публикации одного сообщения из батча
+type PublishResult struct {
+	Ack PublishAck
+	Err error
+}
+
+// ErrNotSupported клиент не реализует опциональное расширение MqClient
+var ErrNotSupported = errors.New("not supported by mq client")
+
+// Publisher минимальный интерфейс публикации, его реализует любой MqClient
+type Publisher interface {
+	Publish(ctx context.Context, subj string, data []byte) error
+}
+
+/*
+PublishMessage
+Публикует через MsgPublisher, если publisher его реализует. Иначе через Publish:
+заголовки и MsgId не передаются, дедупликации на стороне брокера нет
+*/
+func PublishMessage(ctx context.Context, publisher Publisher, msg PublishMsg) (PublishAck, error) {
+	if msgPublisher, ok := publisher.(MsgPublisher); ok {
+		return msgPublisher.PublishMsg(ctx, msg)
+	}
+	return PublishAck{}, publisher.Publish(ctx, msg.Subject, msg.Data)
+}
+
+// PublishMessages публикует через BatchPublisher, если publisher его реализует, иначе по одному через PublishMessage
+func PublishMessages(ctx context.Context, publisher Publisher, msgs []PublishMsg) []PublishResult {
+	if batchPublisher, ok := publisher.(BatchPublisher); ok {
+		return batchPublisher.PublishBatch(ctx, msgs)
+	}
+
+	results := make([]PublishResult, len(msgs))
+	for i, msg := range msgs {
+		results[i].Ack, results[i].Err = PublishMessage(ctx, publisher, msg)
+	}
+	return results
+}
+
+// Request запрос через Requester, ErrNotSupported если клиент его не реализует
+func Request(ctx context.Context, client MqClient, subj string, data []byte) ([]byte, error) {
+	requester, ok := client.(Requester)
+	if !ok {
+		return nil, errors.Wrap(ErrNotSupported, "request")
+	}
+	return requester.Request(ctx, subj, data)
+}
+
+// Reply регистрация обработчиков запросов через Requester, ErrNotSupported если клиент его не реализует
+func Reply(ctx context.Context, client MqClient, queueGroup string, handlers map[string]MqReplyHandler) error {
+	requester, ok := client.(Requester)
+	if !ok {
+		return errors.Wrap(ErrNotSupported, "reply")
+	}
+	return requester.Reply(ctx, queueGroup, handlers)
+}
@@ -0,0 +1,99 @@
+package mqClient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type plainPublisher struct {
+	published []string
+	err       error
+}
+
+func (p *plainPublisher) Publish(ctx context.Context, subj string, data []byte) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, subj+":"+string(data))
+	return nil
+}
+
+type batchPublisher struct {
+	plainPublisher
+	batches int
+}
+
+func (p *batchPublisher) PublishBatch(ctx context.Context, msgs []PublishMsg) []PublishResult {
+	p.batches++
+	return make([]PublishResult, len(msgs))
+}
+
+func TestPublishMessagesFallsBackToPublish(t *testing.T) {
+	publisher := &plainPublisher{}
+	msgs := []PublishMsg{
+		{Subject: "a", Data: []byte("1"), MsgId: "id-1"},
+		{Subject: "b", Data: []byte("2")},
+	}
+
+	results := PublishMessages(context.Background(), publisher, msgs)
+	if len(results) != len(msgs) {
+		t.Fatalf("len(results) = %d, want %d", len(results), len(msgs))
+	}
+	for i, res := range results {
+		if res.Err != nil {
+			t.Errorf("results[%d].Err = %v", i, res.Err)
+		}
+	}
+	if len(publisher.published) != 2 || publisher.published[0] != "a:1" || publisher.published[1] != "b:2" {
+		t.Errorf("published = %v", publisher.published)
+	}
+
+	publisher.err = errors.New("broker down")
+	results = PublishMessages(context.Background(), publisher, msgs)
+	for i, res := range results {
+		if !errors.Is(res.Err, publisher.err) {
+			t.Errorf("results[%d].Err = %v, want %v", i, res.Err, publisher.err)
+		}
+	}
+}
+
+func TestPublishMessagesUsesBatchPublisher(t *testing.T) {
+	publisher := &batchPublisher{}
+
+	results := PublishMessages(context.Background(), publisher, []PublishMsg{{Subject: "a"}, {Subject: "b"}})
+	if len(results) != 2 {
+		t.Fatalf("len(results) = %d, want 2", len(results))
+	}
+	if publisher.batches != 1 || len(publisher.published) != 0 {
+		t.Errorf("batches = %d, published = %v, want one batch and no Publish calls", publisher.batches, publisher.published)
+	}
+}
+
+type subscribeOnlyClient struct {
+	plainPublisher
+}
+
+func (c *subscribeOnlyClient) Subscribe(ctx context.Context, handlers map[string]map[string]MqMsgHandler) error {
+	return nil
+}
+
+func (c *subscribeOnlyClient) SubscribeV2(ctx context.Context, streamsConsumers map[string]map[string]MqMsgHandler) error {
+	return nil
+}
+
+func (c *subscribeOnlyClient) Close(ctx context.Context) error {
+	return nil
+}
+
+func TestRequestReplyNotSupported(t *testing.T) {
+	client := &subscribeOnlyClient{}
+
+	if _, err := Request(context.Background(), client, "svc.lookup", nil); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Request err = %v, want ErrNotSupported", err)
+	}
+	if err := Reply(context.Background(), client, "", nil); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Reply err = %v, want ErrNotSupported", err)
+	}
+}
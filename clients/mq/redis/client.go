@@ -0,0 +1,318 @@
+package mqRedis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	fieldSubject = "subject"
+	fieldData    = "data"
+	fieldHeaders = "headers"
+	fieldMsgId   = "msgId"
+
+	msgIdKeyPrefix = "mq:msgid:"
+
+	defaultDedupWindow = 2 * time.Minute
+)
+
+type Config interface {
+	ServiceName() string
+}
+
+type RedisClient interface {
+	Client() *redis.Client
+}
+
+/*
+Client
+Реализация mqClient.MqClient поверх Redis Streams для окружений без nats.
+  - стрим - ключ redis. Сабжект попадает в стрим, объявленный через WithStream,
+    иначе в стрим с именем сабжекта
+  - консумер из SubscribeV2 - consumer group, инстансы сервиса читают группу под своими именами
+  - успешно обработанные сообщения подтверждаются XACK, необработанные остаются в pending
+    и после ClaimMinIdle забираются XAUTOCLAIM (в том числе у упавших инстансов)
+  - RetryAfter не поддерживается: повторная доставка всегда через ClaimMinIdle
+*/
+type Client struct {
+	cfg    Config
+	client *redis.Client
+	opts   options
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+type stream struct {
+	name     string
+	subjects []string
+}
+
+type options struct {
+	streams       []stream
+	consumerName  string
+	batchSize     int64
+	block         time.Duration
+	claimMinIdle  time.Duration
+	claimInterval time.Duration
+	maxDeliver    int64
+	dedupWindow   time.Duration
+	maxLen        int64
+	middlewares   []mqClient.MqMiddleware
+}
+
+type Option func(opts *options)
+
+// WithStream сообщения сабжектов subjects (поддерживаются * и >) публикуются в стрим name
+func WithStream(name string, subjects ...string) Option {
+	return func(opts *options) {
+		opts.streams = append(opts.streams, stream{name: name, subjects: subjects})
+	}
+}
+
+// WithConsumerName имя инстанса внутри consumer group, по умолчанию ServiceName_hostname
+func WithConsumerName(name string) Option {
+	return func(opts *options) {
+		opts.consumerName = name
+	}
+}
+
+// WithBatchSize сколько сообщений читается за один XREADGROUP/XAUTOCLAIM
+func WithBatchSize(batchSize int64) Option {
+	return func(opts *options) {
+		opts.batchSize = batchSize
+	}
+}
+
+// WithClaim через minIdle необработанное сообщение забирается на повторную обработку, проверка раз в interval
+func WithClaim(minIdle time.Duration, interval time.Duration) Option {
+	return func(opts *options) {
+		opts.claimMinIdle = minIdle
+		opts.claimInterval = interval
+	}
+}
+
+// WithMaxDeliver после maxDeliver доставок сообщение подтверждается без обработки
+func WithMaxDeliver(maxDeliver int64) Option {
+	return func(opts *options) {
+		opts.maxDeliver = maxDeliver
+	}
+}
+
+// WithDedupWindow окно дедупликации сообщений с MsgId
+func WithDedupWindow(window time.Duration) Option {
+	return func(opts *options) {
+		opts.dedupWindow = window
+	}
+}
+
+// WithMaxLen приблизительный максимальный размер стрима (XADD MAXLEN ~), 0 - без ограничения
+func WithMaxLen(maxLen int64) Option {
+	return func(opts *options) {
+		opts.maxLen = maxLen
+	}
+}
+
+// WithMiddlewares middlewares для всех консумеров клиента
+func WithMiddlewares(middlewares ...mqClient.MqMiddleware) Option {
+	return func(opts *options) {
+		opts.middlewares = append(opts.middlewares, middlewares...)
+	}
+}
+
+func New(ctx context.Context, cfg Config, redisClient RedisClient, opts ...Option) (mqClient.MqClient, error) {
+	c := &Client{
+		cfg:    cfg,
+		client: redisClient.Client(),
+		stop:   make(chan struct{}),
+		opts: options{
+			batchSize:     10,
+			block:         5 * time.Second,
+			claimMinIdle:  30 * time.Second,
+			claimInterval: 10 * time.Second,
+			dedupWindow:   defaultDedupWindow,
+		},
+	}
+	for _, apply := range opts {
+		apply(&c.opts)
+	}
+	if c.opts.dedupWindow < time.Millisecond {
+		c.opts.dedupWindow = defaultDedupWindow
+	}
+
+	if len(c.opts.consumerName) == 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = uuid.NewV4().String()
+		}
+		c.opts.consumerName = fmt.Sprintf("%s_%s", cfg.ServiceName(), hostname)
+	}
+
+	log := logger.From(ctx)
+	log.Info().Msgf("redis mq client started, consumer name %s", c.opts.consumerName)
+	return c, nil
+}
+
+func (c *Client) streamName(subject string) string {
+	for _, s := range c.opts.streams {
+		if mqClient.SubjectMatchesAny(s.subjects, subject) {
+			return s.name
+		}
+	}
+	return subject
+}
+
+func (c *Client) Publish(ctx context.Context, subj string, data []byte) error {
+	_, err := c.PublishMsg(ctx, mqClient.PublishMsg{
+		Subject: subj,
+		Data:    data,
+	})
+	return err
+}
+
+/*
+publishScript
+Проверка дедупликации, XADD и запись ключа дедупликации одним атомарным шагом:
+ключ пишется только после успешного XADD, поэтому неудачная публикация не оставляет
+ключ, из-за которого повтор посчитался бы дубликатом.
+KEYS: стрим, [ключ дедупликации]. ARGV: окно дедупликации (ms), maxLen, поля сообщения.
+Для дубликата возвращает nil
+*/
+var publishScript = redis.NewScript(`
+if KEYS[2] and redis.call('exists', KEYS[2]) == 1 then
+	return false
+end
+local id
+if tonumber(ARGV[2]) > 0 then
+	id = redis.call('xadd', KEYS[1], 'maxlen', '~', ARGV[2], '*', unpack(ARGV, 3))
+else
+	id = redis.call('xadd', KEYS[1], '*', unpack(ARGV, 3))
+end
+if KEYS[2] then
+	redis.call('set', KEYS[2], id, 'px', ARGV[1])
+end
+return id
+`)
+
+/*
+PublishMsg
+Сообщение с MsgId публикуется, только если сообщение с таким MsgId
+не публиковалось в окне дедупликации (WithDedupWindow).
+Redis id сообщения не числовой, поэтому PublishAck.Sequence всегда 0
+*/
+func (c *Client) PublishMsg(ctx context.Context, msg mqClient.PublishMsg) (mqClient.PublishAck, error) {
+	streamName := c.streamName(msg.Subject)
+
+	keys := []string{streamName}
+	if len(msg.MsgId) != 0 {
+		keys = append(keys, msgIdKeyPrefix+streamName+":"+msg.MsgId)
+	}
+
+	args := []interface{}{
+		c.opts.dedupWindow.Milliseconds(),
+		c.opts.maxLen,
+		fieldSubject, msg.Subject,
+		fieldData, msg.Data,
+	}
+	if len(msg.MsgId) != 0 {
+		args = append(args, fieldMsgId, msg.MsgId)
+	}
+	if len(msg.Headers) != 0 {
+		headersBts, err := json.Marshal(msg.Headers)
+		if err != nil {
+			return mqClient.PublishAck{}, errors.Wrap(err, "failed to marshal headers")
+		}
+		args = append(args, fieldHeaders, headersBts)
+	}
+
+	err := publishScript.Run(ctx, c.client, keys, args...).Err()
+	if errors.Is(err, redis.Nil) {
+		return mqClient.PublishAck{Stream: streamName, Duplicate: true}, nil
+	}
+	if err != nil {
+		return mqClient.PublishAck{}, errors.WithStack(err)
+	}
+	return mqClient.PublishAck{Stream: streamName}, nil
+}
+
+func (c *Client) PublishBatch(ctx context.Context, msgs []mqClient.PublishMsg) []mqClient.PublishResult {
+	results := make([]mqClient.PublishResult, len(msgs))
+	for i, msg := range msgs {
+		results[i].Ack, results[i].Err = c.PublishMsg(ctx, msg)
+	}
+	return results
+}
+
+/*
+Subscribe
+Deprecated
+Для каждого сабжекта создается consumer group ServiceName_subject,
+сообщения других сабжектов стрима группа подтверждает без обработки
+*/
+func (c *Client) Subscribe(ctx context.Context, handlers map[string]map[string]mqClient.MqMsgHandler) error {
+	for streamName, subjectHandlers := range handlers {
+		if streamName == mqClient.PubsubKey {
+			return errors.New("redis mq client doesnt support pubsub subscriptions")
+		}
+
+		for subject, handler := range subjectHandlers {
+			group := fmt.Sprintf("%s_%s", c.cfg.ServiceName(), subject)
+			if err := c.subscribeGroup(ctx, streamName, group, subject, handler); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/*
+SubscribeV2
+
+	streamConsumers: {
+		"stream": {
+			"consumerGroup": handler,
+		}
+	}
+
+Группа создается, если ее нет, и читает стрим с начала
+*/
+func (c *Client) SubscribeV2(ctx context.Context, streamsConsumers map[string]map[string]mqClient.MqMsgHandler) (subErr error) {
+	for streamName, consumers := range streamsConsumers {
+		for group, handler := range consumers {
+			if err := c.subscribeGroup(ctx, streamName, group, "", handler); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Client) Close(ctx context.Context) error {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "redis mq consumers not stopped")
+	}
+}
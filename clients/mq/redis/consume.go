@@ -0,0 +1,265 @@
+package mqRedis
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	mqMiddleware "github.com/balobas/sport_city_common/clients/mq/middleware"
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+const readErrorDelay = 1 * time.Second
+
+type groupConsumer struct {
+	client  *Client
+	stream  string
+	group   string
+	subject string
+	handler mqClient.MqMsgHandler
+	log     zerolog.Logger
+}
+
+func (c *Client) subscribeGroup(
+	ctx context.Context,
+	streamName string,
+	group string,
+	subject string,
+	handler mqClient.MqMsgHandler,
+) error {
+	err := c.client.XGroupCreateMkStream(ctx, streamName, group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return errors.Wrapf(err, "failed to create consumer group %s on stream %s", group, streamName)
+	}
+
+	gc := &groupConsumer{
+		client:  c,
+		stream:  streamName,
+		group:   group,
+		subject: subject,
+		handler: mqClient.Chain(handler, append([]mqClient.MqMiddleware{mqMiddleware.Recovery()}, c.opts.middlewares...)...),
+		log: logger.From(ctx).With().Fields(map[string]interface{}{
+			"component": "mqRedis",
+			"stream":    streamName,
+			"group":     group,
+			"consumer":  c.opts.consumerName,
+		}).Logger(),
+	}
+
+	c.wg.Add(2)
+	go func() {
+		defer c.wg.Done()
+		gc.readLoop(ctx)
+	}()
+	go func() {
+		defer c.wg.Done()
+		gc.claimLoop(ctx)
+	}()
+
+	gc.log.Info().Msg("successfully init consumer group")
+	return nil
+}
+
+func (gc *groupConsumer) stopped(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	case <-gc.client.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (gc *groupConsumer) wait(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-gc.client.stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// readLoop читает новые сообщения группы
+func (gc *groupConsumer) readLoop(ctx context.Context) {
+	c := gc.client
+
+	for !gc.stopped(ctx) {
+		streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    gc.group,
+			Consumer: c.opts.consumerName,
+			Streams:  []string{gc.stream, ">"},
+			Count:    c.opts.batchSize,
+			Block:    c.opts.block,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if gc.stopped(ctx) {
+				return
+			}
+			gc.log.Warn().Err(err).Msg("failed to read from stream")
+			gc.wait(ctx, readErrorDelay)
+			continue
+		}
+
+		for _, s := range streams {
+			for _, msg := range s.Messages {
+				gc.handle(ctx, msg, 1)
+			}
+		}
+	}
+}
+
+/*
+claimLoop
+Забирает сообщения, которые дольше ClaimMinIdle висят в pending у любого инстанса группы
+(ошибка обработки или упавший инстанс), и обрабатывает их повторно
+*/
+func (gc *groupConsumer) claimLoop(ctx context.Context) {
+	c := gc.client
+
+	for gc.wait(ctx, c.opts.claimInterval) {
+		start := "0-0"
+		for {
+			msgs, next, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+				Stream:   gc.stream,
+				Group:    gc.group,
+				Consumer: c.opts.consumerName,
+				MinIdle:  c.opts.claimMinIdle,
+				Start:    start,
+				Count:    c.opts.batchSize,
+			}).Result()
+			if err != nil {
+				if !gc.stopped(ctx) {
+					gc.log.Warn().Err(err).Msg("failed to autoclaim pending messages")
+				}
+				break
+			}
+
+			deliveries := gc.deliveryCounts(ctx, msgs)
+			for _, msg := range msgs {
+				if gc.stopped(ctx) {
+					return
+				}
+				gc.handle(ctx, msg, deliveries[msg.ID])
+			}
+
+			if next == "0-0" || len(msgs) == 0 {
+				break
+			}
+			start = next
+		}
+	}
+}
+
+/*
+deliveryCounts
+Количество доставок забранных сообщений (XAUTOCLAIM уже увеличил его на 1).
+XPENDING запрашивается по каждому id (одним pipeline), иначе в диапазон попадают
+pending сообщения других консумеров группы и вытесняют забранные из ответа
+*/
+func (gc *groupConsumer) deliveryCounts(ctx context.Context, msgs []redis.XMessage) map[string]int64 {
+	res := make(map[string]int64, len(msgs))
+	if len(msgs) == 0 {
+		return res
+	}
+
+	cmds := make([]*redis.XPendingExtCmd, len(msgs))
+	_, err := gc.client.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, msg := range msgs {
+			cmds[i] = pipe.XPendingExt(ctx, &redis.XPendingExtArgs{
+				Stream:   gc.stream,
+				Group:    gc.group,
+				Start:    msg.ID,
+				End:      msg.ID,
+				Count:    1,
+				Consumer: gc.client.opts.consumerName,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		gc.log.Warn().Err(err).Msg("failed to get pending messages delivery count")
+	}
+
+	for _, cmd := range cmds {
+		pending, err := cmd.Result()
+		if err != nil {
+			continue
+		}
+		for _, p := range pending {
+			res[p.ID] = p.RetryCount
+		}
+	}
+	return res
+}
+
+func (gc *groupConsumer) handle(ctx context.Context, msg redis.XMessage, numDelivered int64) {
+	c := gc.client
+	subject, _ := msg.Values[fieldSubject].(string)
+
+	if len(gc.subject) != 0 && subject != gc.subject {
+		gc.ack(ctx, msg.ID)
+		return
+	}
+
+	if c.opts.maxDeliver > 0 && numDelivered > c.opts.maxDeliver {
+		gc.log.Error().Msgf("message %s exceeded max deliver %d, drop", msg.ID, c.opts.maxDeliver)
+		gc.ack(ctx, msg.ID)
+		return
+	}
+
+	data, _ := msg.Values[fieldData].(string)
+	meta := mqClient.Meta{
+		Subject:      subject,
+		Stream:       gc.stream,
+		Consumer:     gc.group,
+		NumDelivered: uint64(numDelivered),
+	}
+	if headersStr, ok := msg.Values[fieldHeaders].(string); ok {
+		if err := json.Unmarshal([]byte(headersStr), &meta.Headers); err != nil {
+			gc.log.Warn().Err(err).Msgf("failed to unmarshal headers of message %s", msg.ID)
+		}
+	}
+	if ms, err := redisIdTime(msg.ID); err == nil {
+		meta.Timestamp = ms
+	}
+
+	err := gc.handler(mqClient.ContextWithMeta(ctx, meta), []byte(data))
+	if err != nil {
+		gc.log.Error().Err(err).Msgf("failed to handle message %s", msg.ID)
+		if !mqClient.IsTerminateError(err) {
+			return
+		}
+	}
+	gc.ack(ctx, msg.ID)
+}
+
+func (gc *groupConsumer) ack(ctx context.Context, id string) {
+	if err := gc.client.client.XAck(ctx, gc.stream, gc.group, id).Err(); err != nil {
+		gc.log.Error().Err(err).Msgf("failed to ack message %s", id)
+	}
+}
+
+// redisIdTime время добавления сообщения из его id (<ms>-<seq>)
+func redisIdTime(id string) (time.Time, error) {
+	msStr, _, _ := strings.Cut(id, "-")
+	ms, err := strconv.ParseInt(msStr, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.WithStack(err)
+	}
+	return time.UnixMilli(ms).UTC(), nil
+}
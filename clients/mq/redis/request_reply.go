@@ -0,0 +1,177 @@
+package mqRedis
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	replyChannelPrefix    = "mq:reply:"
+	defaultRequestTimeout = 30 * time.Second
+)
+
+var ErrNoResponders = errors.New("no responders for request")
+
+type request struct {
+	ReplyTo  string `json:"replyTo"`
+	Deadline int64  `json:"deadline,omitempty"`
+	Data     []byte `json:"data"`
+}
+
+type reply struct {
+	Data  []byte `json:"data"`
+	Error string `json:"error,omitempty"`
+}
+
+// ReplyError ошибка, которую вернул обработчик запроса
+type ReplyError struct {
+	Subject string
+	Message string
+}
+
+func (e *ReplyError) Error() string {
+	return "reply handler error on " + e.Subject + ": " + e.Message
+}
+
+/*
+Request
+Запрос через redis pub/sub. Без дедлайна в ctx ждет ответ defaultRequestTimeout.
+Если на сабжект никто не подписан, возвращает ErrNoResponders
+*/
+func (c *Client) Request(ctx context.Context, subj string, data []byte) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultRequestTimeout)
+		defer cancel()
+	}
+	deadline, _ := ctx.Deadline()
+
+	replyTo := replyChannelPrefix + uuid.NewV4().String()
+	sub := c.client.Subscribe(ctx, replyTo)
+	defer sub.Close()
+
+	if _, err := sub.Receive(ctx); err != nil {
+		return nil, errors.Wrapf(err, "failed to subscribe on reply channel for %s", subj)
+	}
+
+	reqBts, err := json.Marshal(request{
+		ReplyTo:  replyTo,
+		Deadline: deadline.UnixNano(),
+		Data:     data,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	receivers, err := c.client.Publish(ctx, subj, reqBts).Result()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to publish request to %s", subj)
+	}
+	if receivers == 0 {
+		return nil, errors.Wrap(ErrNoResponders, subj)
+	}
+
+	select {
+	case msg, ok := <-sub.Channel():
+		if !ok {
+			return nil, errors.Errorf("reply channel for %s closed", subj)
+		}
+
+		var resp reply
+		if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+			return nil, errors.Wrapf(err, "failed to unmarshal reply from %s", subj)
+		}
+		if len(resp.Error) != 0 {
+			return nil, &ReplyError{Subject: subj, Message: resp.Error}
+		}
+		return resp.Data, nil
+	case <-ctx.Done():
+		return nil, errors.Wrapf(ctx.Err(), "waiting for reply from %s", subj)
+	}
+}
+
+/*
+Reply
+Подписывает обработчики запросов на сабжекты через redis pub/sub.
+Redis не поддерживает queue groups: запрос получают все инстансы, в ответ
+запрашивающему уходит первый ответ, queueGroup игнорируется
+*/
+func (c *Client) Reply(ctx context.Context, queueGroup string, handlers map[string]mqClient.MqReplyHandler) error {
+	log := logger.From(ctx).With().Str("component", "mqRedis").Logger()
+
+	for subject, handler := range handlers {
+		sub := c.client.Subscribe(ctx, subject)
+		if _, err := sub.Receive(ctx); err != nil {
+			sub.Close()
+			return errors.Wrapf(err, "failed to subscribe reply handler on %s", subject)
+		}
+
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			defer sub.Close()
+
+			ch := sub.Channel()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-c.stop:
+					return
+				case msg, ok := <-ch:
+					if !ok {
+						return
+					}
+					c.handleRequest(ctx, subject, msg.Payload, handler)
+				}
+			}
+		}()
+		log.Info().Msgf("successfully subscribed reply handler on %s", subject)
+	}
+	return nil
+}
+
+func (c *Client) handleRequest(ctx context.Context, subject string, payload string, handler mqClient.MqReplyHandler) {
+	log := logger.From(ctx).With().Fields(map[string]interface{}{
+		"layer":     "handlers",
+		"layerType": "mqReply",
+		"subject":   subject,
+	}).Logger()
+
+	var req request
+	if err := json.Unmarshal([]byte(payload), &req); err != nil {
+		log.Error().Err(err).Msg("failed to unmarshal request")
+		return
+	}
+
+	reqCtx := mqClient.ContextWithMeta(ctx, mqClient.Meta{Subject: subject})
+	if req.Deadline != 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithDeadline(reqCtx, time.Unix(0, req.Deadline))
+		defer cancel()
+	}
+
+	var resp reply
+	data, err := handler(reqCtx, req.Data)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to handle request %s", req.Data)
+		resp.Error = err.Error()
+	} else {
+		resp.Data = data
+	}
+
+	respBts, err := json.Marshal(resp)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal reply")
+		return
+	}
+	if err := c.client.Publish(ctx, req.ReplyTo, respBts).Err(); err != nil {
+		log.Error().Err(err).Msg("failed to publish reply")
+	}
+}
@@ -0,0 +1,155 @@
+package mqClient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	outboxEntity "github.com/balobas/sport_city_common/entity/outbox"
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/pkg/errors"
+)
+
+type EnvelopeHandler func(ctx context.Context, env outboxEntity.Envelope) error
+
+// Upcaster переводит payload версии version в версию version+1
+type Upcaster func(payload json.RawMessage) (json.RawMessage, error)
+
+type routeKey struct {
+	msgType string
+	version int
+}
+
+func (k routeKey) String() string {
+	return fmt.Sprintf("%s v%d", k.msgType, k.version)
+}
+
+/*
+Router
+Диспетчеризация сообщений одного консумера (outboxEntity.Envelope) по (type, version).
+Если для версии сообщения нет хендлера, payload поднимается апкастерами до версии, для которой он есть:
+
+	router := mqClient.NewRouter().
+		Upcast("media.usage", 1, mediaUsageV1ToV2).
+		Handle("media.usage", 2, mqClient.HandleEnvelopeJSON(uc.HandleMediaUsage))
+
+	nc.SubscribeV2(ctx, map[string]map[string]mqClient.MqMsgHandler{
+		"media": {"media_consumer": router.Handler()},
+	})
+
+Сообщения без хендлера терминируются (или пропускаются с WithIgnoreUnknown)
+*/
+type Router struct {
+	handlers  map[routeKey]EnvelopeHandler
+	upcasters map[routeKey]Upcaster
+
+	ignoreUnknown bool
+	legacyHandler MqMsgHandler
+}
+
+type RouterOption func(r *Router)
+
+// WithIgnoreUnknown сообщения неизвестных type/version подтверждаются без обработки
+func WithIgnoreUnknown() RouterOption {
+	return func(r *Router) {
+		r.ignoreUnknown = true
+	}
+}
+
+// WithLegacyHandler обработчик сообщений без конверта (без type), например от старых продюсеров
+func WithLegacyHandler(handler MqMsgHandler) RouterOption {
+	return func(r *Router) {
+		r.legacyHandler = handler
+	}
+}
+
+func NewRouter(opts ...RouterOption) *Router {
+	r := &Router{
+		handlers:  map[routeKey]EnvelopeHandler{},
+		upcasters: map[routeKey]Upcaster{},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *Router) Handle(msgType string, version int, handler EnvelopeHandler) *Router {
+	r.handlers[routeKey{msgType: msgType, version: version}] = handler
+	return r
+}
+
+// Upcast регистрирует перевод payload msgType из fromVersion в fromVersion+1
+func (r *Router) Upcast(msgType string, fromVersion int, upcaster Upcaster) *Router {
+	r.upcasters[routeKey{msgType: msgType, version: fromVersion}] = upcaster
+	return r
+}
+
+func (r *Router) Handler() MqMsgHandler {
+	return func(ctx context.Context, msgPayload []byte) error {
+		log := logger.From(ctx).With().Str("component", "mqRouter").Logger()
+
+		var env outboxEntity.Envelope
+		if err := json.Unmarshal(msgPayload, &env); err != nil {
+			return Terminate(errors.Wrap(err, "failed to decode message envelope"))
+		}
+
+		if len(env.Type) == 0 {
+			if r.legacyHandler != nil {
+				return r.legacyHandler(ctx, msgPayload)
+			}
+			return Terminate(errors.New("message without envelope type"))
+		}
+
+		key := routeKey{msgType: env.Type, version: env.Version}
+		for {
+			if handler, ok := r.handlers[key]; ok {
+				if key.version != env.Version {
+					log.Debug().Msgf("message %s upcasted to v%d", routeKey{msgType: env.Type, version: env.Version}, key.version)
+					env.Version = key.version
+				}
+				return handler(ctx, env)
+			}
+
+			upcaster, ok := r.upcasters[key]
+			if !ok {
+				break
+			}
+
+			payload, err := upcaster(env.Payload)
+			if err != nil {
+				return Terminate(errors.Wrapf(err, "failed to upcast %s", key))
+			}
+			env.Payload = payload
+			key.version++
+		}
+
+		if r.ignoreUnknown {
+			log.Info().Msgf("no handler for message %s, skip", routeKey{msgType: env.Type, version: env.Version})
+			return nil
+		}
+		return Terminate(errors.Errorf("no handler for message %s", routeKey{msgType: env.Type, version: env.Version}))
+	}
+}
+
+/*
+HandleEnvelopeJSON
+Адаптер типизированного хендлера к EnvelopeHandler, payload декодируется из json.
+Ошибки декодирования и валидации (Validator) терминируют сообщение
+*/
+func HandleEnvelopeJSON[T any](handler func(ctx context.Context, payload T, env outboxEntity.Envelope) error) EnvelopeHandler {
+	return func(ctx context.Context, env outboxEntity.Envelope) error {
+		var payload T
+		if err := json.Unmarshal(env.Payload, &payload); err != nil {
+			return Terminate(errors.Wrapf(err, "failed to decode %s v%d payload", env.Type, env.Version))
+		}
+
+		if validator, ok := any(&payload).(Validator); ok {
+			if err := validator.Validate(); err != nil {
+				return Terminate(errors.Wrapf(err, "invalid %s v%d payload", env.Type, env.Version))
+			}
+		}
+
+		return handler(ctx, payload, env)
+	}
+}
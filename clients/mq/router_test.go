@@ -0,0 +1,128 @@
+package mqClient
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	outboxEntity "github.com/balobas/sport_city_common/entity/outbox"
+	"github.com/pkg/errors"
+)
+
+type usageV2 struct {
+	MediaUid string `json:"mediaUid"`
+	Domain   string `json:"domain"`
+}
+
+func (p *usageV2) Validate() error {
+	if len(p.Domain) == 0 {
+		return errors.New("empty domain")
+	}
+	return nil
+}
+
+func mustEnvelope(t *testing.T, msgType string, version int, payload any) []byte {
+	t.Helper()
+
+	env, err := outboxEntity.NewEnvelope(msgType, version, "test", payload)
+	if err != nil {
+		t.Fatalf("NewEnvelope: %v", err)
+	}
+	data, err := json.Marshal(env)
+	if err != nil {
+		t.Fatalf("marshal envelope: %v", err)
+	}
+	return data
+}
+
+func TestRouterDispatchesByTypeAndVersion(t *testing.T) {
+	var got usageV2
+	router := NewRouter().
+		Handle("media.usage", 2, HandleEnvelopeJSON(func(ctx context.Context, payload usageV2, env outboxEntity.Envelope) error {
+			got = payload
+			return nil
+		}))
+
+	msg := mustEnvelope(t, "media.usage", 2, usageV2{MediaUid: "m1", Domain: "events"})
+	if err := router.Handler()(context.Background(), msg); err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	if got.MediaUid != "m1" || got.Domain != "events" {
+		t.Errorf("payload = %+v", got)
+	}
+}
+
+func TestRouterUpcastsToHandledVersion(t *testing.T) {
+	var (
+		got        usageV2
+		gotVersion int
+	)
+	router := NewRouter().
+		Upcast("media.usage", 1, func(payload json.RawMessage) (json.RawMessage, error) {
+			var v1 struct {
+				MediaUid string `json:"mediaUid"`
+			}
+			if err := json.Unmarshal(payload, &v1); err != nil {
+				return nil, err
+			}
+			return json.Marshal(usageV2{MediaUid: v1.MediaUid, Domain: "legacy"})
+		}).
+		Handle("media.usage", 2, HandleEnvelopeJSON(func(ctx context.Context, payload usageV2, env outboxEntity.Envelope) error {
+			got, gotVersion = payload, env.Version
+			return nil
+		}))
+
+	msg := mustEnvelope(t, "media.usage", 1, map[string]string{"mediaUid": "m1"})
+	if err := router.Handler()(context.Background(), msg); err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	if got.MediaUid != "m1" || got.Domain != "legacy" || gotVersion != 2 {
+		t.Errorf("payload = %+v, version = %d", got, gotVersion)
+	}
+}
+
+func TestRouterTerminates(t *testing.T) {
+	router := NewRouter().
+		Handle("media.usage", 2, HandleEnvelopeJSON(func(ctx context.Context, payload usageV2, env outboxEntity.Envelope) error {
+			return nil
+		}))
+
+	tests := []struct {
+		name string
+		msg  []byte
+	}{
+		{name: "not json", msg: []byte("not json")},
+		{name: "without type", msg: []byte(`{"payload":{}}`)},
+		{name: "unknown type", msg: mustEnvelope(t, "media.deleted", 1, struct{}{})},
+		{name: "unknown version without upcaster", msg: mustEnvelope(t, "media.usage", 1, struct{}{})},
+		{name: "invalid payload", msg: mustEnvelope(t, "media.usage", 2, usageV2{MediaUid: "m1"})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := router.Handler()(context.Background(), tt.msg)
+			if !IsTerminateError(err) {
+				t.Errorf("err = %v, want terminate error", err)
+			}
+		})
+	}
+}
+
+func TestRouterOptions(t *testing.T) {
+	unknown := mustEnvelope(t, "media.deleted", 1, struct{}{})
+	if err := NewRouter(WithIgnoreUnknown()).Handler()(context.Background(), unknown); err != nil {
+		t.Errorf("ignore unknown: err = %v", err)
+	}
+
+	var legacyCalled bool
+	router := NewRouter(WithLegacyHandler(func(ctx context.Context, msgPayload []byte) error {
+		legacyCalled = true
+		return nil
+	}))
+	if err := router.Handler()(context.Background(), []byte(`{"mediaUid":"m1"}`)); err != nil {
+		t.Fatalf("legacy handler: err = %v", err)
+	}
+	if !legacyCalled {
+		t.Error("legacy handler not called for message without type")
+	}
+}
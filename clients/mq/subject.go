@@ -0,0 +1,31 @@
+package mqClient
+
+import "strings"
+
+// SubjectMatches сопоставление с wildcard в стиле nats: "*" - один токен, ">" - один и более токенов в конце
+func SubjectMatches(pattern string, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) {
+			return false
+		}
+		if token != "*" && token != subjectTokens[i] {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
+
+func SubjectMatchesAny(patterns []string, subject string) bool {
+	for _, pattern := range patterns {
+		if SubjectMatches(pattern, subject) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package mqClient
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type msgWithTraceId struct {
+	TraceId string `json:"traceId"`
+}
+
+/*
+ContextWithPayloadTraceId
+Достает traceId из json payload (outboxEntity.BaseMsgPayload) и кладет его в ctx.
+Используется для сообщений без заголовков трейса (старые продюсеры, outbox)
+*/
+func ContextWithPayloadTraceId(ctx context.Context, msgPayload []byte) (context.Context, error) {
+	var msgTraceInfo msgWithTraceId
+	if err := json.Unmarshal(msgPayload, &msgTraceInfo); err != nil {
+		return ctx, errors.Wrap(err, "failed to unmarshal traceId from message")
+	}
+
+	traceId, err := trace.TraceIDFromHex(msgTraceInfo.TraceId)
+	if err != nil {
+		return ctx, errors.Wrap(err, "invalid trace id")
+	}
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceId,
+	})
+	return trace.ContextWithSpanContext(ctx, spanContext), nil
+}
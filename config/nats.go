@@ -0,0 +1,87 @@
+package commonConfig
+
+import "os"
+
+// NatsSecurityConfig реализует natsClient.SecurityConfig, встраивается в конфиг сервиса
+type NatsSecurityConfig struct {
+	tlsCAFile    string
+	tlsCertFile  string
+	tlsKeyFile   string
+	credsFile    string
+	nkeySeedFile string
+	user         string
+	password     string
+	token        string
+}
+
+const (
+	NatsEnvTLSCAFile    = "NATS_TLS_CA_FILE"
+	NatsEnvTLSCertFile  = "NATS_TLS_CERT_FILE"
+	NatsEnvTLSKeyFile   = "NATS_TLS_KEY_FILE"
+	NatsEnvCredsFile    = "NATS_CREDS_FILE"
+	NatsEnvNKeySeedFile = "NATS_NKEY_SEED_FILE"
+	NatsEnvUser         = "NATS_USER"
+	NatsEnvPassword     = "NATS_PASSWORD"
+	NatsEnvToken        = "NATS_TOKEN"
+)
+
+var natsSecurityEnvs = []string{
+	NatsEnvTLSCAFile, NatsEnvTLSCertFile, NatsEnvTLSKeyFile, NatsEnvCredsFile,
+	NatsEnvNKeySeedFile, NatsEnvUser, NatsEnvPassword, NatsEnvToken,
+}
+
+// NatsSecurityEnvsSet заданные переменные окружения безопасности nats
+func NatsSecurityEnvsSet() []string {
+	var res []string
+	for _, env := range natsSecurityEnvs {
+		if len(os.Getenv(env)) != 0 {
+			res = append(res, env)
+		}
+	}
+	return res
+}
+
+func ParseNatsSecurityConfig() *NatsSecurityConfig {
+	return &NatsSecurityConfig{
+		tlsCAFile:    os.Getenv(NatsEnvTLSCAFile),
+		tlsCertFile:  os.Getenv(NatsEnvTLSCertFile),
+		tlsKeyFile:   os.Getenv(NatsEnvTLSKeyFile),
+		credsFile:    os.Getenv(NatsEnvCredsFile),
+		nkeySeedFile: os.Getenv(NatsEnvNKeySeedFile),
+		user:         os.Getenv(NatsEnvUser),
+		password:     os.Getenv(NatsEnvPassword),
+		token:        os.Getenv(NatsEnvToken),
+	}
+}
+
+func (nc *NatsSecurityConfig) NatsTLSCAFile() string {
+	return nc.tlsCAFile
+}
+
+func (nc *NatsSecurityConfig) NatsTLSCertFile() string {
+	return nc.tlsCertFile
+}
+
+func (nc *NatsSecurityConfig) NatsTLSKeyFile() string {
+	return nc.tlsKeyFile
+}
+
+func (nc *NatsSecurityConfig) NatsCredsFile() string {
+	return nc.credsFile
+}
+
+func (nc *NatsSecurityConfig) NatsNKeySeedFile() string {
+	return nc.nkeySeedFile
+}
+
+func (nc *NatsSecurityConfig) NatsUser() string {
+	return nc.user
+}
+
+func (nc *NatsSecurityConfig) NatsPassword() string {
+	return nc.password
+}
+
+func (nc *NatsSecurityConfig) NatsToken() string {
+	return nc.token
+}
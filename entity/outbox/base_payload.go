@@ -6,3 +6,8 @@ type BaseMsgPayload struct {
 	MsgUid  uuid.UUID `json:"msgUid"`
 	TraceId string    `json:"traceId"`
 }
+
+// SetBaseMsgPayload позволяет заполнить встроенный BaseMsgPayload у любого payload (outbox.Enqueue)
+func (p *BaseMsgPayload) SetBaseMsgPayload(base BaseMsgPayload) {
+	*p = base
+}
@@ -0,0 +1,50 @@
+package outboxEntity
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+/*
+Envelope
+Стандартный конверт сообщения. Поля BaseMsgPayload лежат на верхнем уровне,
+поэтому дедупликация по msgUid и traceId из payload работают как для обычных сообщений:
+
+	{
+		"msgUid": "...",
+		"traceId": "...",
+		"type": "media.usage",
+		"version": 2,
+		"occurredAt": "2024-01-01T00:00:00Z",
+		"producer": "events_service",
+		"payload": {...}
+	}
+*/
+type Envelope struct {
+	BaseMsgPayload
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	OccurredAt time.Time       `json:"occurredAt"`
+	Producer   string          `json:"producer"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+func NewEnvelope(msgType string, version int, producer string, payload any) (Envelope, error) {
+	payloadBts, err := json.Marshal(payload)
+	if err != nil {
+		return Envelope{}, errors.Wrapf(err, "failed to marshal %s v%d payload", msgType, version)
+	}
+
+	env := Envelope{
+		Type:       msgType,
+		Version:    version,
+		OccurredAt: time.Now().UTC(),
+		Producer:   producer,
+		Payload:    payloadBts,
+	}
+	env.MsgUid = uuid.NewV4()
+	return env, nil
+}
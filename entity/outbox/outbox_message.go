@@ -14,4 +14,17 @@ type Message struct {
 	UpdatedAt        time.Time
 	LastErrorMessage string
 	SendAt           time.Time
+	Headers          map[string][]string
+	// PartitionKey сообщения с одним ключом публикуются строго в порядке создания
+	PartitionKey string
+
+	// Attempts количество неудачных попыток публикации, NextAttemptAt время следующей попытки после ошибки,
+	// FailedAt время, когда сообщение признано неотправляемым (попытки исчерпаны)
+	Attempts      int
+	NextAttemptAt time.Time
+	FailedAt      time.Time
+
+	// LockedBy, LockedUntil аренда сообщения инстансом паблишера, пустые значения снимают аренду
+	LockedBy    string
+	LockedUntil time.Time
 }
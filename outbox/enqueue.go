@@ -0,0 +1,123 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	outboxEntity "github.com/balobas/sport_city_common/entity/outbox"
+	"github.com/balobas/sport_city_common/tracer"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Payload payload, встраивающий outboxEntity.BaseMsgPayload
+type Payload[T any] interface {
+	*T
+	SetBaseMsgPayload(base outboxEntity.BaseMsgPayload)
+}
+
+type enqueueOptions struct {
+	deliverAfter time.Time
+	headers      map[string][]string
+	partitionKey string
+	withoutTx    bool
+}
+
+type EnqueueOption func(opts *enqueueOptions)
+
+// WithDeliverAfter сообщение будет опубликовано не раньше t
+func WithDeliverAfter(t time.Time) EnqueueOption {
+	return func(opts *enqueueOptions) {
+		opts.deliverAfter = t
+	}
+}
+
+// WithHeaders заголовки, с которыми сообщение будет опубликовано
+func WithHeaders(headers map[string][]string) EnqueueOption {
+	return func(opts *enqueueOptions) {
+		opts.headers = headers
+	}
+}
+
+// WithPartitionKey сообщения с одним ключом публикуются строго в порядке Enqueue
+func WithPartitionKey(key string) EnqueueOption {
+	return func(opts *enqueueOptions) {
+		opts.partitionKey = key
+	}
+}
+
+// WithoutTx разрешает запись без транзакции в ctx
+func WithoutTx() EnqueueOption {
+	return func(opts *enqueueOptions) {
+		opts.withoutTx = true
+	}
+}
+
+/*
+Enqueue
+Заполняет BaseMsgPayload (msgUid, traceId текущего спана), маршалит payload и пишет
+сообщение в outbox в транзакции из ctx. Без транзакции возвращает ErrNoTxInCtx (см. WithoutTx).
+Возвращает msgUid, он же uid сообщения outbox и MsgId при публикации
+*/
+func Enqueue[T any, P Payload[T]](ctx context.Context, subject string, payload T, opts ...EnqueueOption) (uuid.UUID, error) {
+	ctx, span := tracer.FromCtx(ctx).Start(ctx, "Outbox.Enqueue")
+	defer span.End()
+	span.SetAttributes(attribute.String("subject", subject))
+
+	log := loggerFromCtx(ctx).With().Fields(map[string]interface{}{
+		"method":  "Enqueue",
+		"subject": subject,
+	}).Logger()
+
+	o := FromCtx(ctx)
+	if o == nil {
+		return uuid.Nil, errors.WithStack(ErrNotInitialized)
+	}
+
+	var options enqueueOptions
+	for _, apply := range opts {
+		apply(&options)
+	}
+
+	if _, ok := o.db.GetTxFromCtx(ctx); !ok && !options.withoutTx {
+		err := errors.Wrapf(ErrNoTxInCtx, "enqueue message into %s", subject)
+		span.RecordError(err)
+		return uuid.Nil, err
+	}
+
+	msgUid := uuid.NewV4()
+	P(&payload).SetBaseMsgPayload(outboxEntity.BaseMsgPayload{
+		MsgUid:  msgUid,
+		TraceId: span.SpanContext().TraceID().String(),
+	})
+
+	payloadBts, err := json.Marshal(payload)
+	if err != nil {
+		span.RecordError(err, trace.WithStackTrace(true))
+		log.Debug().Str("error", err.Error()).Msg("failed to marshal msg payload")
+		return uuid.Nil, errors.WithStack(err)
+	}
+
+	msg := outboxEntity.Message{
+		Uid:          msgUid,
+		SubjectName:  subject,
+		Payload:      payloadBts,
+		Headers:      options.headers,
+		PartitionKey: options.partitionKey,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if !options.deliverAfter.IsZero() {
+		msg.NextAttemptAt = options.deliverAfter.UTC()
+	}
+
+	if err := o.repo.CreateMessage(ctx, msg); err != nil {
+		span.RecordError(err)
+		return uuid.Nil, errors.Wrapf(err, "failed to enqueue message into %s", subject)
+	}
+
+	log.Debug().Msgf("message %s enqueued", msgUid)
+	return msgUid, nil
+}
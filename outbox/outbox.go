@@ -0,0 +1,75 @@
+package outbox
+
+import (
+	"context"
+
+	clientDB "github.com/balobas/sport_city_common/clients/database"
+	outboxEntity "github.com/balobas/sport_city_common/entity/outbox"
+	"github.com/balobas/sport_city_common/logger"
+	outboxRepository "github.com/balobas/sport_city_common/repository/outbox"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrNotInitialized = errors.New("outbox is not initialized")
+	ErrNoTxInCtx      = errors.New("no transaction in ctx")
+)
+
+var defaultOutbox *Outbox
+
+type Repository interface {
+	CreateMessage(ctx context.Context, message outboxEntity.Message) error
+}
+
+/*
+Outbox
+Точка записи доменных событий в outbox_messages. Сообщение пишется в транзакции
+из ctx (ClientDB.BeginTxWithContext / transaction.Manager), поэтому попадает в outbox
+только вместе с изменениями, которые его породили:
+
+	outbox.Init(db)
+	...
+	err := txManager.ExecuteTx(ctx, common.ReadCommitted, func(ctx context.Context) error {
+		...
+		_, err := outbox.Enqueue(ctx, "media.usage", outboxEntity.MediaUsagePayload{...})
+		return err
+	})
+*/
+type Outbox struct {
+	db   clientDB.ClientDB
+	repo Repository
+}
+
+func New(db clientDB.ClientDB) *Outbox {
+	return &Outbox{
+		db:   db,
+		repo: outboxRepository.New(db),
+	}
+}
+
+// Init задает Outbox по умолчанию для Enqueue
+func Init(db clientDB.ClientDB) {
+	defaultOutbox = New(db)
+}
+
+type outboxCtxKey struct{}
+
+// ContextWithOutbox Outbox для Enqueue вместо заданного через Init
+func ContextWithOutbox(ctx context.Context, o *Outbox) context.Context {
+	return context.WithValue(ctx, outboxCtxKey{}, o)
+}
+
+func FromCtx(ctx context.Context) *Outbox {
+	if o, ok := ctx.Value(outboxCtxKey{}).(*Outbox); ok {
+		return o
+	}
+	return defaultOutbox
+}
+
+func loggerFromCtx(ctx context.Context) zerolog.Logger {
+	return logger.From(ctx).With().Fields(map[string]interface{}{
+		"layer":     "usecase",
+		"component": "outbox",
+	}).Logger()
+}
@@ -0,0 +1,26 @@
+package inboxRepository
+
+import (
+	"context"
+	"time"
+
+	pgEntity "github.com/balobas/sport_city_common/repository/postgres/entity"
+	"github.com/pkg/errors"
+)
+
+func (r *InboxRepository) DeleteProcessedBefore(ctx context.Context, t time.Time) error {
+	log := repoLoggerFromCtx(ctx).With().Fields(map[string]interface{}{
+		"method": "DeleteProcessedBefore",
+		"before": t,
+	}).Logger()
+	log.Debug().Send()
+
+	row := &pgEntity.InboxMessageRow{}
+
+	if err := r.Delete(ctx, row, row.ConditionProcessedAtLess(t)); err != nil {
+		err = errors.Wrap(err, "query failed")
+		log.Debug().Str("error", err.Error()).Send()
+		return errors.WithStack(err)
+	}
+	return nil
+}
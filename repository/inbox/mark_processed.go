@@ -0,0 +1,53 @@
+package inboxRepository
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	pgEntity "github.com/balobas/sport_city_common/repository/postgres/entity"
+	"github.com/balobas/sport_city_common/tracer"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// MarkProcessed возвращает false, если сообщение уже было обработано консумером
+func (r *InboxRepository) MarkProcessed(ctx context.Context, msgUid uuid.UUID, consumer string) (bool, error) {
+	ctx, span := tracer.FromCtx(ctx).Start(ctx, "InboxRepository.MarkProcessed")
+	defer span.End()
+
+	log := repoLoggerFromCtx(ctx).With().Fields(map[string]interface{}{
+		"method":   "MarkProcessed",
+		"msgUid":   msgUid,
+		"consumer": consumer,
+	}).Logger()
+	log.Debug().Send()
+
+	row := pgEntity.NewInboxMessageRow(msgUid, consumer, time.Now())
+
+	sql, args, err := sq.Insert(
+		row.Table(),
+	).PlaceholderFormat(
+		sq.Dollar,
+	).Columns(
+		row.Columns()...,
+	).Values(
+		row.Values()...,
+	).Suffix("on conflict do nothing").ToSql()
+	if err != nil {
+		err = errors.Wrap(err, "failed to build sql for MarkProcessed")
+		span.RecordError(err)
+		log.Debug().Str("error", err.Error()).Send()
+		return false, errors.WithStack(err)
+	}
+
+	tag, err := r.Exec(ctx, sql, args...)
+	if err != nil {
+		err = errors.Wrap(err, "query failed")
+		span.RecordError(err)
+		log.Debug().Str("error", err.Error()).Send()
+		return false, errors.WithStack(err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,39 @@
+package inboxRepository
+
+import (
+	"context"
+
+	clientDB "github.com/balobas/sport_city_common/clients/database"
+	"github.com/balobas/sport_city_common/logger"
+	repositoryBasePostgres "github.com/balobas/sport_city_common/repository/postgres"
+	"github.com/rs/zerolog"
+)
+
+/*
+InboxRepository
+Хранит uid уже обработанных консумером сообщений. Ожидаемая таблица:
+
+	create table inbox_messages (
+		msg_uid uuid not null,
+		consumer text not null,
+		processed_at timestamp not null,
+		primary key (msg_uid, consumer)
+	);
+	create index inbox_messages_processed_at_idx on inbox_messages (processed_at);
+*/
+type InboxRepository struct {
+	*repositoryBasePostgres.BasePgRepository
+}
+
+func New(client clientDB.ClientDB) *InboxRepository {
+	return &InboxRepository{
+		repositoryBasePostgres.New(client),
+	}
+}
+
+func repoLoggerFromCtx(ctx context.Context) zerolog.Logger {
+	return logger.From(ctx).With().Fields(map[string]interface{}{
+		"layer":     "repository",
+		"component": "inboxRepository",
+	}).Logger()
+}
@@ -0,0 +1,34 @@
+package notifyPayloadRepository
+
+import (
+	"context"
+	"time"
+
+	pgEntity "github.com/balobas/sport_city_common/repository/postgres/entity"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+func (r *NotifyPayloadRepository) CreatePayload(
+	ctx context.Context,
+	uid uuid.UUID,
+	subject string,
+	data []byte,
+	headers []byte,
+) error {
+	log := repoLoggerFromCtx(ctx).With().Fields(map[string]interface{}{
+		"method":  "CreatePayload",
+		"uid":     uid,
+		"subject": subject,
+	}).Logger()
+	log.Debug().Send()
+
+	row := pgEntity.NewNotifyPayloadRow(uid, subject, data, headers, time.Now())
+
+	if err := r.Create(ctx, row); err != nil {
+		err = errors.Wrap(err, "query failed")
+		log.Debug().Str("error", err.Error()).Send()
+		return errors.WithStack(err)
+	}
+	return nil
+}
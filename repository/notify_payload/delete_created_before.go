@@ -0,0 +1,26 @@
+package notifyPayloadRepository
+
+import (
+	"context"
+	"time"
+
+	pgEntity "github.com/balobas/sport_city_common/repository/postgres/entity"
+	"github.com/pkg/errors"
+)
+
+func (r *NotifyPayloadRepository) DeleteCreatedBefore(ctx context.Context, t time.Time) error {
+	log := repoLoggerFromCtx(ctx).With().Fields(map[string]interface{}{
+		"method": "DeleteCreatedBefore",
+		"before": t,
+	}).Logger()
+	log.Debug().Send()
+
+	row := &pgEntity.NotifyPayloadRow{}
+
+	if err := r.Delete(ctx, row, row.ConditionCreatedAtLess(t)); err != nil {
+		err = errors.Wrap(err, "query failed")
+		log.Debug().Str("error", err.Error()).Send()
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package notifyPayloadRepository
+
+import (
+	"context"
+
+	pgEntity "github.com/balobas/sport_city_common/repository/postgres/entity"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+func (r *NotifyPayloadRepository) GetPayload(ctx context.Context, uid uuid.UUID) (*pgEntity.NotifyPayloadRow, error) {
+	log := repoLoggerFromCtx(ctx).With().Fields(map[string]interface{}{
+		"method": "GetPayload",
+		"uid":    uid,
+	}).Logger()
+	log.Debug().Send()
+
+	row := &pgEntity.NotifyPayloadRow{Uid: pgEntity.PgUidFromUUID(uid)}
+
+	if err := r.GetOne(ctx, row, row.ConditionUidEqual()); err != nil {
+		err = errors.Wrap(err, "query failed")
+		log.Debug().Str("error", err.Error()).Send()
+		return nil, errors.WithStack(err)
+	}
+	return row, nil
+}
@@ -0,0 +1,41 @@
+package notifyPayloadRepository
+
+import (
+	"context"
+
+	clientDB "github.com/balobas/sport_city_common/clients/database"
+	"github.com/balobas/sport_city_common/logger"
+	repositoryBasePostgres "github.com/balobas/sport_city_common/repository/postgres"
+	"github.com/rs/zerolog"
+)
+
+/*
+NotifyPayloadRepository
+Хранит payload сообщений mqPostgres, которые не помещаются в pg_notify (8000 байт).
+Ожидаемая таблица:
+
+	create table mq_notify_payloads (
+		uid uuid primary key,
+		subject text not null,
+		data bytea not null,
+		headers jsonb,
+		created_at timestamp not null
+	);
+	create index mq_notify_payloads_created_at_idx on mq_notify_payloads (created_at);
+*/
+type NotifyPayloadRepository struct {
+	*repositoryBasePostgres.BasePgRepository
+}
+
+func New(client clientDB.ClientDB) *NotifyPayloadRepository {
+	return &NotifyPayloadRepository{
+		repositoryBasePostgres.New(client),
+	}
+}
+
+func repoLoggerFromCtx(ctx context.Context) zerolog.Logger {
+	return logger.From(ctx).With().Fields(map[string]interface{}{
+		"layer":     "repository",
+		"component": "notifyPayloadRepository",
+	}).Logger()
+}
@@ -0,0 +1,43 @@
+package outboxRepository
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+/*
+TryAdvisoryLock
+Берет session advisory lock по имени на выделенном соединении из GetMasterPool.
+Если лок занят, возвращает locked == false. unlock снимает лок и возвращает соединение в пул.
+Если инстанс упадет, лок снимется вместе с закрытием соединения
+*/
+func (r *OutboxRepository) TryAdvisoryLock(ctx context.Context, name string) (unlock func(), locked bool, err error) {
+	log := repoLoggerFromCtx(ctx).With().Fields(map[string]interface{}{
+		"method": "TryAdvisoryLock",
+		"lock":   name,
+	}).Logger()
+
+	conn, err := r.db.GetMasterPool().Acquire(ctx)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to acquire connection for advisory lock")
+	}
+
+	if err := conn.QueryRow(ctx, "select pg_try_advisory_lock(hashtext($1))", name).Scan(&locked); err != nil {
+		conn.Release()
+		return nil, false, errors.Wrapf(err, "failed to take advisory lock %s", name)
+	}
+	if !locked {
+		conn.Release()
+		return nil, false, nil
+	}
+
+	return func() {
+		if _, err := conn.Exec(context.Background(), "select pg_advisory_unlock(hashtext($1))", name); err != nil {
+			log.Warn().Err(err).Msg("failed to release advisory lock, closing connection")
+			// закрытое соединение пул не переиспользует, лок снимется вместе с сессией
+			conn.Conn().Close(context.Background())
+		}
+		conn.Release()
+	}, true, nil
+}
@@ -0,0 +1,82 @@
+package outboxRepository
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	outboxEntity "github.com/balobas/sport_city_common/entity/outbox"
+	pgEntity "github.com/balobas/sport_city_common/repository/postgres/entity"
+	"github.com/jackc/pgtype"
+	"github.com/pkg/errors"
+)
+
+/*
+ClaimMessagesForPublish
+Арендует до batchSize неотправленных сообщений, у которых наступило время попытки,
+на lease для инстанса owner и возвращает их. Строки выбираются через FOR UPDATE SKIP LOCKED, поэтому параллельные паблишеры получают
+разные сообщения. Сообщения с истекшей арендой (инстанс упал посреди батча) снова доступны
+для захвата. Из партиции (PartitionKey) захватывается только самое раннее неотправленное
+сообщение, следующее будет доступно после его отправки. Аренду снимает UpdateMessage с пустыми LockedBy/LockedUntil
+*/
+func (r *OutboxRepository) ClaimMessagesForPublish(
+	ctx context.Context,
+	owner string,
+	lease time.Duration,
+	batchSize int64,
+) ([]outboxEntity.Message, error) {
+	log := repoLoggerFromCtx(ctx).With().Fields(map[string]interface{}{
+		"method": "ClaimMessagesForPublish",
+		"owner":  owner,
+	}).Logger()
+
+	msgRow := pgEntity.NewOutboxMessageRow()
+	now := time.Now().UTC()
+
+	claimable := sq.Select(
+		msgRow.IdColumnName(),
+	).From(
+		msgRow.Table(),
+	).Where(sq.And{
+		msgRow.ConditionSendAtIsNull(),
+		msgRow.ConditionReadyForAttempt(now),
+		msgRow.ConditionFirstInPartition(),
+		msgRow.ConditionLeaseExpired(now),
+	}).OrderBy("created_at").Limit(uint64(batchSize)).Suffix("for update skip locked")
+
+	sql, args, err := sq.Update(
+		msgRow.Table(),
+	).PlaceholderFormat(
+		sq.Dollar,
+	).Set(
+		"locked_by", owner,
+	).Set(
+		"locked_until", pgtype.Timestamp{Time: now.Add(lease), Status: pgtype.Present},
+	).Where(
+		sq.Expr(msgRow.IdColumnName()+" in (?)", claimable),
+	).Suffix(
+		"returning " + strings.Join(msgRow.Columns(), ", "),
+	).ToSql()
+	if err != nil {
+		err = errors.Wrap(err, "failed to build sql for ClaimMessagesForPublish")
+		log.Debug().Str("error", err.Error()).Send()
+		return nil, errors.WithStack(err)
+	}
+
+	rows, err := r.Query(ctx, sql, args...)
+	if err != nil {
+		err = errors.Wrap(err, "query failed")
+		log.Debug().Str("error", err.Error()).Send()
+		return nil, errors.WithStack(err)
+	}
+
+	msgRows := pgEntity.NewOutboxMessageRows()
+	if err := msgRows.ScanAll(rows); err != nil {
+		err = errors.Wrap(err, "scan failed")
+		log.Debug().Str("error", err.Error()).Send()
+		return nil, errors.WithStack(err)
+	}
+
+	return msgRows.ToEntity(), nil
+}
@@ -0,0 +1,46 @@
+package outboxRepository
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	pgEntity "github.com/balobas/sport_city_common/repository/postgres/entity"
+	"github.com/pkg/errors"
+)
+
+// DeleteSentBefore удаляет до batchSize сообщений, отправленных раньше t, возвращает количество удаленных
+func (r *OutboxRepository) DeleteSentBefore(ctx context.Context, t time.Time, batchSize int64) (int64, error) {
+	log := repoLoggerFromCtx(ctx).With().Str("method", "DeleteSentBefore").Logger()
+
+	msgRow := pgEntity.NewOutboxMessageRow()
+
+	batch := sq.Select(
+		msgRow.IdColumnName(),
+	).From(
+		msgRow.Table(),
+	).Where(
+		msgRow.ConditionSentBefore(t),
+	).Limit(uint64(batchSize)).Suffix("for update skip locked")
+
+	sql, args, err := sq.Delete(
+		msgRow.Table(),
+	).PlaceholderFormat(
+		sq.Dollar,
+	).Where(
+		sq.Expr(msgRow.IdColumnName()+" in (?)", batch),
+	).ToSql()
+	if err != nil {
+		err = errors.Wrap(err, "failed to build sql for DeleteSentBefore")
+		log.Debug().Str("error", err.Error()).Send()
+		return 0, errors.WithStack(err)
+	}
+
+	tag, err := r.Exec(ctx, sql, args...)
+	if err != nil {
+		err = errors.Wrap(err, "query failed")
+		log.Debug().Str("error", err.Error()).Send()
+		return 0, errors.WithStack(err)
+	}
+	return tag.RowsAffected(), nil
+}
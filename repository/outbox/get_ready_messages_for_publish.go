@@ -2,6 +2,7 @@ package outboxRepository
 
 import (
 	"context"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	outboxEntity "github.com/balobas/sport_city_common/entity/outbox"
@@ -9,6 +10,7 @@ import (
 	"github.com/pkg/errors"
 )
 
+// GetReadyMessagesForPublish не блокирует сообщения, для нескольких инстансов паблишера используйте ClaimMessagesForPublish
 func (r *OutboxRepository) GetReadyMessagesForPublish(ctx context.Context, batchSize int64) ([]outboxEntity.Message, error) {
 	log := repoLoggerFromCtx(ctx).With().Str("method", "GetReadyMessagesForPublish").Logger()
 	// log.Debug().Msgf("outboxRepository.GetReadyMessagesForPublish: batch size %d", batchSize)
@@ -21,9 +23,10 @@ func (r *OutboxRepository) GetReadyMessagesForPublish(ctx context.Context, batch
 		msgRow.Table(),
 	).PlaceholderFormat(
 		sq.Dollar,
-	).Where(
+	).Where(sq.And{
 		msgRow.ConditionSendAtIsNull(),
-	).OrderBy("created_at").Limit(uint64(batchSize)).ToSql()
+		msgRow.ConditionReadyForAttempt(time.Now().UTC()),
+	}).OrderBy("created_at").Limit(uint64(batchSize)).ToSql()
 	if err != nil {
 		err = errors.Wrap(err, "failed to build sql for GetReadyMessagesForPublish")
 		log.Debug().Str("error", err.Error()).Send()
@@ -0,0 +1,52 @@
+package outboxRepository
+
+import (
+	"context"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	pgEntity "github.com/balobas/sport_city_common/repository/postgres/entity"
+	"github.com/pkg/errors"
+)
+
+// MoveFailedToDead переносит до batchSize неотправляемых сообщений (failed_at) в outbox_dead, возвращает количество перенесенных
+func (r *OutboxRepository) MoveFailedToDead(ctx context.Context, batchSize int64) (int64, error) {
+	log := repoLoggerFromCtx(ctx).With().Str("method", "MoveFailedToDead").Logger()
+
+	msgRow := pgEntity.NewOutboxMessageRow()
+	columns := strings.Join(msgRow.Columns(), ", ")
+
+	batch := sq.Select(
+		msgRow.IdColumnName(),
+	).From(
+		msgRow.Table(),
+	).Where(
+		msgRow.ConditionFailed(),
+	).Limit(uint64(batchSize)).Suffix("for update skip locked")
+
+	deleted, args, err := sq.Delete(
+		msgRow.Table(),
+	).PlaceholderFormat(
+		sq.Dollar,
+	).Where(
+		sq.Expr(msgRow.IdColumnName()+" in (?)", batch),
+	).Suffix(
+		"returning " + columns,
+	).ToSql()
+	if err != nil {
+		err = errors.Wrap(err, "failed to build sql for MoveFailedToDead")
+		log.Debug().Str("error", err.Error()).Send()
+		return 0, errors.WithStack(err)
+	}
+
+	sql := "with moved as (" + deleted + ") " +
+		"insert into " + msgRow.DeadTable() + " (" + columns + ") select " + columns + " from moved"
+
+	tag, err := r.Exec(ctx, sql, args...)
+	if err != nil {
+		err = errors.Wrap(err, "query failed")
+		log.Debug().Str("error", err.Error()).Send()
+		return 0, errors.WithStack(err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -9,13 +9,36 @@ import (
 	"github.com/rs/zerolog"
 )
 
+/*
+OutboxRepository
+Таблице outbox_messages нужны колонки заголовков, партиции, аренды и учета попыток:
+
+	alter table outbox_messages
+		add column headers jsonb,
+		add column partition_key text,
+		add column locked_by text,
+		add column locked_until timestamp,
+		add column attempts int not null default 0,
+		add column next_attempt_at timestamp,
+		add column failed_at timestamp;
+	create index outbox_messages_ready_idx on outbox_messages (created_at)
+		where send_at is null and failed_at is null;
+	create index outbox_messages_partition_idx on outbox_messages (partition_key, created_at)
+		where send_at is null and failed_at is null;
+
+Для MoveFailedToDead нужна таблица outbox_dead с теми же колонками:
+
+	create table outbox_dead (like outbox_messages including all);
+*/
 type OutboxRepository struct {
 	*repositoryBasePostgres.BasePgRepository
+	db clientDB.ClientDB
 }
 
 func New(client clientDB.ClientDB) *OutboxRepository {
 	return &OutboxRepository{
-		repositoryBasePostgres.New(client),
+		BasePgRepository: repositoryBasePostgres.New(client),
+		db:               client,
 	}
 }
 
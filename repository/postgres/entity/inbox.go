@@ -0,0 +1,60 @@
+package repositoryBaseEntityPostgres
+
+import (
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	uuid "github.com/satori/go.uuid"
+)
+
+type InboxMessageRow struct {
+	MsgUid      pgtype.UUID
+	Consumer    string
+	ProcessedAt pgtype.Timestamp
+}
+
+func NewInboxMessageRow(msgUid uuid.UUID, consumer string, processedAt time.Time) *InboxMessageRow {
+	return &InboxMessageRow{
+		MsgUid:      PgUidFromUUID(msgUid),
+		Consumer:    consumer,
+		ProcessedAt: PgUtcTimestampFromTime(processedAt),
+	}
+}
+
+func (m *InboxMessageRow) Values() []interface{} {
+	return []interface{}{
+		m.MsgUid, m.Consumer, m.ProcessedAt,
+	}
+}
+
+func (m *InboxMessageRow) Columns() []string {
+	return []string{
+		"msg_uid", "consumer", "processed_at",
+	}
+}
+
+func (m *InboxMessageRow) Table() string {
+	return "inbox_messages"
+}
+
+func (m *InboxMessageRow) Scan(row pgx.Row) error {
+	return row.Scan(&m.MsgUid, &m.Consumer, &m.ProcessedAt)
+}
+
+func (m *InboxMessageRow) ColumnsForUpdate() []string {
+	return []string{
+		"processed_at",
+	}
+}
+
+func (m *InboxMessageRow) ValuesForUpdate() []interface{} {
+	return []interface{}{
+		m.ProcessedAt,
+	}
+}
+
+func (m *InboxMessageRow) ConditionProcessedAtLess(t time.Time) sq.Lt {
+	return sq.Lt{"processed_at": PgUtcTimestampFromTime(t)}
+}
@@ -0,0 +1,68 @@
+package repositoryBaseEntityPostgres
+
+import (
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	uuid "github.com/satori/go.uuid"
+)
+
+type NotifyPayloadRow struct {
+	Uid       pgtype.UUID
+	Subject   string
+	Data      []byte
+	Headers   []byte
+	CreatedAt pgtype.Timestamp
+}
+
+func NewNotifyPayloadRow(uid uuid.UUID, subject string, data []byte, headers []byte, createdAt time.Time) *NotifyPayloadRow {
+	return &NotifyPayloadRow{
+		Uid:       PgUidFromUUID(uid),
+		Subject:   subject,
+		Data:      data,
+		Headers:   headers,
+		CreatedAt: PgUtcTimestampFromTime(createdAt),
+	}
+}
+
+func (m *NotifyPayloadRow) Values() []interface{} {
+	return []interface{}{
+		m.Uid, m.Subject, m.Data, m.Headers, m.CreatedAt,
+	}
+}
+
+func (m *NotifyPayloadRow) Columns() []string {
+	return []string{
+		"uid", "subject", "data", "headers", "created_at",
+	}
+}
+
+func (m *NotifyPayloadRow) Table() string {
+	return "mq_notify_payloads"
+}
+
+func (m *NotifyPayloadRow) Scan(row pgx.Row) error {
+	return row.Scan(&m.Uid, &m.Subject, &m.Data, &m.Headers, &m.CreatedAt)
+}
+
+func (m *NotifyPayloadRow) ColumnsForUpdate() []string {
+	return []string{
+		"subject", "data", "headers",
+	}
+}
+
+func (m *NotifyPayloadRow) ValuesForUpdate() []interface{} {
+	return []interface{}{
+		m.Subject, m.Data, m.Headers,
+	}
+}
+
+func (m *NotifyPayloadRow) ConditionUidEqual() sq.Eq {
+	return sq.Eq{"uid": m.Uid}
+}
+
+func (m *NotifyPayloadRow) ConditionCreatedAtLess(t time.Time) sq.Lt {
+	return sq.Lt{"created_at": PgUtcTimestampFromTime(t)}
+}
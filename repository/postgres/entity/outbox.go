@@ -1,6 +1,7 @@
 package repositoryBaseEntityPostgres
 
 import (
+	"encoding/json"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
@@ -17,6 +18,13 @@ type OutboxMessageRow struct {
 	UpdatedAt        pgtype.Timestamp
 	LastErrorMessage string
 	SendAt           pgtype.Timestamp
+	Headers          []byte
+	PartitionKey     pgtype.Text
+	LockedBy         pgtype.Text
+	LockedUntil      pgtype.Timestamp
+	Attempts         int32
+	NextAttemptAt    pgtype.Timestamp
+	FailedAt         pgtype.Timestamp
 }
 
 func NewOutboxMessageRow() *OutboxMessageRow {
@@ -48,11 +56,43 @@ func (m *OutboxMessageRow) FromEntity(mqMessage outboxEntity.Message) *OutboxMes
 	if mqMessage.SendAt.Equal(time.Time{}) {
 		m.SendAt.Status = pgtype.Null
 	}
+	m.Headers = nil
+	if len(mqMessage.Headers) != 0 {
+		// map[string][]string всегда маршалится
+		m.Headers, _ = json.Marshal(mqMessage.Headers)
+	}
+	m.PartitionKey = pgtype.Text{String: mqMessage.PartitionKey, Status: pgtype.Present}
+	if len(mqMessage.PartitionKey) == 0 {
+		m.PartitionKey.Status = pgtype.Null
+	}
+	m.LockedBy = pgtype.Text{String: mqMessage.LockedBy, Status: pgtype.Present}
+	if len(mqMessage.LockedBy) == 0 {
+		m.LockedBy.Status = pgtype.Null
+	}
+	m.LockedUntil = pgtype.Timestamp{Time: mqMessage.LockedUntil, Status: pgtype.Present}
+	if mqMessage.LockedUntil.Equal(time.Time{}) {
+		m.LockedUntil.Status = pgtype.Null
+	}
+	m.Attempts = int32(mqMessage.Attempts)
+	m.NextAttemptAt = pgtype.Timestamp{Time: mqMessage.NextAttemptAt, Status: pgtype.Present}
+	if mqMessage.NextAttemptAt.Equal(time.Time{}) {
+		m.NextAttemptAt.Status = pgtype.Null
+	}
+	m.FailedAt = pgtype.Timestamp{Time: mqMessage.FailedAt, Status: pgtype.Present}
+	if mqMessage.FailedAt.Equal(time.Time{}) {
+		m.FailedAt.Status = pgtype.Null
+	}
 
 	return m
 }
 
 func (m *OutboxMessageRow) ToEntity() outboxEntity.Message {
+	var headers map[string][]string
+	if len(m.Headers) != 0 {
+		// колонка заполняется только через FromEntity
+		_ = json.Unmarshal(m.Headers, &headers)
+	}
+
 	return outboxEntity.Message{
 		Uid:              m.Uid.Bytes,
 		SubjectName:      m.SubjectName,
@@ -61,6 +101,13 @@ func (m *OutboxMessageRow) ToEntity() outboxEntity.Message {
 		CreatedAt:        m.CreatedAt.Time,
 		UpdatedAt:        m.UpdatedAt.Time,
 		SendAt:           m.SendAt.Time,
+		Headers:          headers,
+		PartitionKey:     m.PartitionKey.String,
+		LockedBy:         m.LockedBy.String,
+		LockedUntil:      m.LockedUntil.Time,
+		Attempts:         int(m.Attempts),
+		NextAttemptAt:    m.NextAttemptAt.Time,
+		FailedAt:         m.FailedAt.Time,
 	}
 }
 
@@ -71,12 +118,14 @@ func (m *OutboxMessageRow) IdColumnName() string {
 func (m *OutboxMessageRow) Values() []interface{} {
 	return []interface{}{
 		m.Uid, m.SubjectName, m.Payload, m.CreatedAt, m.UpdatedAt, m.LastErrorMessage, m.SendAt,
+		m.Headers, m.PartitionKey, m.LockedBy, m.LockedUntil, m.Attempts, m.NextAttemptAt, m.FailedAt,
 	}
 }
 
 func (m *OutboxMessageRow) Columns() []string {
 	return []string{
 		"uid", "subject_name", "payload", "created_at", "updated_at", "last_error_msg", "send_at",
+		"headers", "partition_key", "locked_by", "locked_until", "attempts", "next_attempt_at", "failed_at",
 	}
 }
 
@@ -84,19 +133,29 @@ func (m *OutboxMessageRow) Table() string {
 	return "outbox_messages"
 }
 
+// DeadTable таблица для неотправляемых сообщений (failed_at), колонки те же
+func (m *OutboxMessageRow) DeadTable() string {
+	return "outbox_dead"
+}
+
 func (m *OutboxMessageRow) Scan(row pgx.Row) error {
-	return row.Scan(&m.Uid, &m.SubjectName, &m.Payload, &m.CreatedAt, &m.UpdatedAt, &m.LastErrorMessage, &m.SendAt)
+	return row.Scan(
+		&m.Uid, &m.SubjectName, &m.Payload, &m.CreatedAt, &m.UpdatedAt, &m.LastErrorMessage, &m.SendAt,
+		&m.Headers, &m.PartitionKey, &m.LockedBy, &m.LockedUntil, &m.Attempts, &m.NextAttemptAt, &m.FailedAt,
+	)
 }
 
 func (m *OutboxMessageRow) ColumnsForUpdate() []string {
 	return []string{
-		"updated_at", "last_error_msg", "send_at",
+		"updated_at", "last_error_msg", "send_at", "locked_by", "locked_until",
+		"attempts", "next_attempt_at", "failed_at",
 	}
 }
 
 func (m *OutboxMessageRow) ValuesForUpdate() []interface{} {
 	return []interface{}{
-		m.UpdatedAt, m.LastErrorMessage, m.SendAt,
+		m.UpdatedAt, m.LastErrorMessage, m.SendAt, m.LockedBy, m.LockedUntil,
+		m.Attempts, m.NextAttemptAt, m.FailedAt,
 	}
 }
 
@@ -108,6 +167,45 @@ func (m *OutboxMessageRow) ConditionSendAtIsNull() sq.Eq {
 	return sq.Eq{"send_at": pgtype.Timestamp{Status: pgtype.Null}}
 }
 
+// ConditionSentBefore сообщение отправлено раньше t
+func (m *OutboxMessageRow) ConditionSentBefore(t time.Time) sq.Lt {
+	return sq.Lt{"send_at": pgtype.Timestamp{Time: t, Status: pgtype.Present}}
+}
+
+// ConditionFailed сообщение признано неотправляемым
+func (m *OutboxMessageRow) ConditionFailed() sq.NotEq {
+	return sq.NotEq{"failed_at": pgtype.Timestamp{Status: pgtype.Null}}
+}
+
+// ConditionReadyForAttempt сообщение не признано неотправляемым и время следующей попытки наступило
+func (m *OutboxMessageRow) ConditionReadyForAttempt(now time.Time) sq.And {
+	return sq.And{
+		sq.Eq{"failed_at": pgtype.Timestamp{Status: pgtype.Null}},
+		sq.Or{
+			sq.Eq{"next_attempt_at": pgtype.Timestamp{Status: pgtype.Null}},
+			sq.LtOrEq{"next_attempt_at": pgtype.Timestamp{Time: now, Status: pgtype.Present}},
+		},
+	}
+}
+
+// ConditionFirstInPartition в партиции сообщения нет более ранних неотправленных сообщений
+func (m *OutboxMessageRow) ConditionFirstInPartition() sq.Sqlizer {
+	return sq.Expr(`(partition_key is null or not exists (
+		select 1 from outbox_messages prev
+		where prev.partition_key = outbox_messages.partition_key
+			and prev.send_at is null and prev.failed_at is null
+			and prev.created_at < outbox_messages.created_at
+	))`)
+}
+
+// ConditionLeaseExpired сообщение не арендовано или аренда истекла
+func (m *OutboxMessageRow) ConditionLeaseExpired(now time.Time) sq.Or {
+	return sq.Or{
+		sq.Eq{"locked_until": pgtype.Timestamp{Status: pgtype.Null}},
+		sq.Lt{"locked_until": pgtype.Timestamp{Time: now, Status: pgtype.Present}},
+	}
+}
+
 func NewOutboxMessageRows() *Rows[*OutboxMessageRow, outboxEntity.Message] {
 	return &Rows[*OutboxMessageRow, outboxEntity.Message]{}
 }
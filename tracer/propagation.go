@@ -0,0 +1,14 @@
+package tracer
+
+import "go.opentelemetry.io/otel/propagation"
+
+var propagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// Propagator возвращает W3C (traceparent/tracestate + baggage) пропагатор,
+// которым пользуются клиенты для передачи контекста трейса между сервисами
+func Propagator() propagation.TextMapPropagator {
+	return propagator
+}
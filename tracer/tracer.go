@@ -47,6 +47,7 @@ func NewTracerProvider(cfg Config) (*tracesdk.TracerProvider, error) {
 	once.Do(func() {
 		defaultTracer = tp.Tracer(fmt.Sprintf("%s_tracer", cfg.ServiceName()))
 		otel.SetTracerProvider(tp)
+		otel.SetTextMapPropagator(propagator)
 	})
 
 	return tp, nil
@@ -12,7 +12,7 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
-// Deprecated
+// Deprecated: используйте outbox.Enqueue
 func (uc *UcMediaOutbox) CreateMediaUsageMessage(
 	ctx context.Context,
 	domain string,
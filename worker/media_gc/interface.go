@@ -0,0 +1,15 @@
+package workerMediaGC
+
+import (
+	"context"
+	"time"
+)
+
+type Config interface {
+	MediaGCInterval() time.Duration
+	MediaUnusedTTL() time.Duration
+}
+
+type MediaStore interface {
+	CleanupUnused(ctx context.Context, ttl time.Duration) (int, error)
+}
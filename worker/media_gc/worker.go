@@ -0,0 +1,56 @@
+package workerMediaGC
+
+import (
+	"context"
+	"time"
+
+	"github.com/balobas/sport_city_common/logger"
+)
+
+type Worker struct {
+	cfg        Config
+	mediaStore MediaStore
+}
+
+func New(
+	cfg Config,
+	mediaStore MediaStore,
+) *Worker {
+	return &Worker{
+		cfg:        cfg,
+		mediaStore: mediaStore,
+	}
+}
+
+func (w *Worker) Name() string {
+	return "workerMediaGC"
+}
+
+func (w *Worker) Run(ctx context.Context) error {
+	log := logger.From(ctx).With().Fields(map[string]interface{}{
+		"layer":     "worker",
+		"component": "mediaGCWorker",
+	}).Logger()
+	log.Info().Msg("start media gc worker")
+
+	timer := time.NewTimer(w.cfg.MediaGCInterval())
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Info().Msgf("stop media gc worker. ctx done %v\n", ctx.Err())
+			return nil
+		case <-timer.C:
+			deleted, err := w.mediaStore.CleanupUnused(ctx, w.cfg.MediaUnusedTTL())
+			if err != nil {
+				log.Error().Err(err).Msg("failed to cleanup unused media")
+			}
+			if deleted != 0 {
+				log.Info().Msgf("deleted %d unused media", deleted)
+			}
+
+			timer.Reset(w.cfg.MediaGCInterval())
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package workerOutboxCleaner
+
+import (
+	"context"
+	"time"
+)
+
+type Config interface {
+	OutboxCleanupInterval() time.Duration
+	OutboxRetention() time.Duration
+	OutboxCleanupBatchSize() int64
+}
+
+// DeadConfig опциональное расширение Config, включает перенос неотправляемых сообщений в outbox_dead
+type DeadConfig interface {
+	OutboxMoveFailedToDead() bool
+}
+
+type OutboxRepository interface {
+	TryAdvisoryLock(ctx context.Context, name string) (unlock func(), locked bool, err error)
+	DeleteSentBefore(ctx context.Context, t time.Time, batchSize int64) (int64, error)
+	MoveFailedToDead(ctx context.Context, batchSize int64) (int64, error)
+}
@@ -0,0 +1,119 @@
+package workerOutboxCleaner
+
+import (
+	"context"
+	"time"
+
+	"github.com/balobas/sport_city_common/logger"
+	"github.com/rs/zerolog"
+)
+
+const (
+	cleanupLockName  = "outbox_messages_cleanup"
+	defaultBatchSize = 1000
+)
+
+/*
+Worker
+Удаляет отправленные сообщения старше OutboxRetention батчами по OutboxCleanupBatchSize
+и, если включено (DeadConfig), переносит неотправляемые сообщения в outbox_dead.
+Работа выполняется под advisory lock, поэтому в каждом тике чистит только одна реплика
+*/
+type Worker struct {
+	cfg              Config
+	outboxRepository OutboxRepository
+}
+
+func New(
+	cfg Config,
+	outboxRepository OutboxRepository,
+) *Worker {
+	return &Worker{
+		cfg:              cfg,
+		outboxRepository: outboxRepository,
+	}
+}
+
+func (w *Worker) Name() string {
+	return "workerOutboxCleaner"
+}
+
+func (w *Worker) Run(ctx context.Context) error {
+	log := logger.From(ctx).With().Fields(map[string]interface{}{
+		"layer":     "worker",
+		"component": "outboxCleanerWorker",
+	}).Logger()
+	log.Info().Msg("start outbox cleaner worker")
+
+	timer := time.NewTimer(w.cfg.OutboxCleanupInterval())
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Info().Msgf("stop outbox cleaner worker. ctx done %v\n", ctx.Err())
+			return nil
+		case <-timer.C:
+			w.cleanup(ctx, log)
+
+			timer.Reset(w.cfg.OutboxCleanupInterval())
+		}
+	}
+}
+
+func (w *Worker) cleanup(ctx context.Context, log zerolog.Logger) {
+	unlock, locked, err := w.outboxRepository.TryAdvisoryLock(ctx, cleanupLockName)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to take outbox cleanup lock")
+		return
+	}
+	if !locked {
+		log.Debug().Msg("outbox cleanup is running on another instance, skip")
+		return
+	}
+	defer unlock()
+
+	batchSize := w.cfg.OutboxCleanupBatchSize()
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	if deadCfg, ok := w.cfg.(DeadConfig); ok && deadCfg.OutboxMoveFailedToDead() {
+		moved, err := w.runBatches(ctx, batchSize, func() (int64, error) {
+			return w.outboxRepository.MoveFailedToDead(ctx, batchSize)
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("failed to move failed outbox messages to outbox_dead")
+		}
+		if moved != 0 {
+			log.Info().Msgf("moved %d failed outbox messages to outbox_dead", moved)
+		}
+	}
+
+	sentBefore := time.Now().UTC().Add(-w.cfg.OutboxRetention())
+	deleted, err := w.runBatches(ctx, batchSize, func() (int64, error) {
+		return w.outboxRepository.DeleteSentBefore(ctx, sentBefore, batchSize)
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete sent outbox messages")
+	}
+	if deleted != 0 {
+		log.Info().Msgf("deleted %d outbox messages sent before %s", deleted, sentBefore)
+	}
+}
+
+// runBatches вызывает batch, пока он обрабатывает полные батчи
+func (w *Worker) runBatches(ctx context.Context, batchSize int64, batch func() (int64, error)) (int64, error) {
+	var total int64
+	for ctx.Err() == nil {
+		n, err := batch()
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < batchSize {
+			break
+		}
+	}
+	return total, nil
+}
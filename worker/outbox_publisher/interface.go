@@ -12,11 +12,33 @@ type Config interface {
 	MqPublishMessagesBatchSize() int64
 }
 
+// LeaseConfig опциональное расширение Config, по умолчанию аренда defaultLease
+type LeaseConfig interface {
+	MqPublishMessagesLease() time.Duration
+}
+
+/*
+RetryConfig
+Опциональное расширение Config. После ошибки публикации следующая попытка через
+MqPublishRetryMinDelay * 2^(attempts-1), но не больше MqPublishRetryMaxDelay.
+После MqPublishMaxAttempts неудачных попыток сообщение помечается failed_at и больше не публикуется
+*/
+type RetryConfig interface {
+	MqPublishMaxAttempts() int
+	MqPublishRetryMinDelay() time.Duration
+	MqPublishRetryMaxDelay() time.Duration
+}
+
+/*
+Publisher
+Реализуется любым mqClient.MqClient. Если publisher реализует mqClient.BatchPublisher,
+батч публикуется через PublishBatch с MsgId для дедупликации на стороне брокера
+*/
 type Publisher interface {
 	Publish(ctx context.Context, subjectName string, data []byte) error
 }
 
 type OutboxRepository interface {
-	GetReadyMessagesForPublish(ctx context.Context, batchSize int64) ([]outboxEntity.Message, error)
+	ClaimMessagesForPublish(ctx context.Context, owner string, lease time.Duration, batchSize int64) ([]outboxEntity.Message, error)
 	UpdateMessage(ctx context.Context, msg outboxEntity.Message) error
 }
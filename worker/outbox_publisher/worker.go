@@ -2,15 +2,43 @@ package workerOutboxPublisher
 
 import (
 	"context"
+	"os"
 	"time"
 
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
 	"github.com/balobas/sport_city_common/logger"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	uuid "github.com/satori/go.uuid"
 )
 
+const (
+	// defaultLease должна с запасом покрывать публикацию батча
+	defaultLease = time.Minute
+
+	defaultMaxAttempts   = 10
+	defaultRetryMinDelay = time.Second
+	defaultRetryMaxDelay = 10 * time.Minute
+)
+
+var errNoPublishResult = errors.New("publisher returned no result for message")
+
+/*
+Worker
+Каждый инстанс арендует свою пачку сообщений (ClaimMessagesForPublish), поэтому
+воркер можно запускать в нескольких репликах. Если инстанс упал посреди батча,
+его сообщения заберут другие после истечения аренды
+*/
 type Worker struct {
 	cfg              Config
 	outboxRepository OutboxRepository
 	publisher        Publisher
+
+	owner string
+	lease time.Duration
+
+	maxAttempts  int
+	retryBackoff mqClient.ExponentialBackoff
 }
 
 func New(
@@ -18,11 +46,45 @@ func New(
 	outboxRepository OutboxRepository,
 	publisher Publisher,
 ) *Worker {
-	return &Worker{
+	lease := defaultLease
+	if leaseCfg, ok := cfg.(LeaseConfig); ok && leaseCfg.MqPublishMessagesLease() > 0 {
+		lease = leaseCfg.MqPublishMessagesLease()
+	}
+
+	w := &Worker{
 		cfg:              cfg,
 		outboxRepository: outboxRepository,
 		publisher:        publisher,
+		owner:            newOwnerId(),
+		lease:            lease,
+		maxAttempts:      defaultMaxAttempts,
+		retryBackoff: mqClient.ExponentialBackoff{
+			Initial:    defaultRetryMinDelay,
+			Max:        defaultRetryMaxDelay,
+			Multiplier: 2,
+			Jitter:     0.2,
+		},
 	}
+	if retryCfg, ok := cfg.(RetryConfig); ok {
+		if retryCfg.MqPublishMaxAttempts() > 0 {
+			w.maxAttempts = retryCfg.MqPublishMaxAttempts()
+		}
+		if retryCfg.MqPublishRetryMinDelay() > 0 {
+			w.retryBackoff.Initial = retryCfg.MqPublishRetryMinDelay()
+		}
+		if retryCfg.MqPublishRetryMaxDelay() > 0 {
+			w.retryBackoff.Max = retryCfg.MqPublishRetryMaxDelay()
+		}
+	}
+	return w
+}
+
+func newOwnerId() string {
+	host, err := os.Hostname()
+	if err != nil || len(host) == 0 {
+		host = "unknown"
+	}
+	return host + "-" + uuid.NewV4().String()
 }
 
 func (w *Worker) Name() string {
@@ -34,7 +96,7 @@ func (w *Worker) Run(ctx context.Context) error {
 		"layer":     "worker",
 		"component": "publisherWorker",
 	}).Logger()
-	log.Info().Msg("start publisher worker")
+	log.Info().Msgf("start publisher worker %s", w.owner)
 
 	msgsBatchSize := w.cfg.MqPublishMessagesBatchSize()
 	timer := time.NewTimer(w.cfg.MqPublishMessagesInterval())
@@ -53,30 +115,77 @@ func (w *Worker) Run(ctx context.Context) error {
 			default:
 			}
 
-			msgs, err := w.outboxRepository.GetReadyMessagesForPublish(ctx, msgsBatchSize)
-			if err != nil {
-				log.Error().Err(err).Msg("error get ready messages for publish")
-				timer.Reset(w.cfg.MqPublishMessagesInterval())
-				break
+			w.publishReady(ctx, log, msgsBatchSize)
+
+			timer.Reset(w.cfg.MqPublishMessagesInterval())
+		}
+	}
+}
+
+// publishReady арендует пачку сообщений, публикует ее и сохраняет результат по каждому сообщению
+func (w *Worker) publishReady(ctx context.Context, log zerolog.Logger, batchSize int64) {
+	msgs, err := w.outboxRepository.ClaimMessagesForPublish(ctx, w.owner, w.lease, batchSize)
+	if err != nil {
+		log.Error().Err(err).Msg("error get ready messages for publish")
+		return
+	}
+
+	pubMsgs := make([]mqClient.PublishMsg, len(msgs))
+	for i, msg := range msgs {
+		pubMsgs[i] = mqClient.PublishMsg{
+			Subject: msg.SubjectName,
+			Data:    msg.Payload,
+			Headers: msg.Headers,
+			MsgId:   msg.Uid.String(),
+		}
+		if len(msg.PartitionKey) != 0 {
+			headers := make(map[string][]string, len(msg.Headers)+1)
+			for k, v := range msg.Headers {
+				headers[k] = v
 			}
+			headers[mqClient.HeaderPartitionKey] = []string{msg.PartitionKey}
+			pubMsgs[i].Headers = headers
+		}
+	}
+
+	results := mqClient.PublishMessages(ctx, w.publisher, pubMsgs)
+	if len(results) != len(msgs) {
+		log.Error().Msgf("publisher returned %d results for %d messages, messages without result are treated as failed", len(results), len(msgs))
+	}
 
-			for _, msg := range msgs {
-				if err := w.publisher.Publish(ctx, msg.SubjectName, msg.Payload); err != nil {
-					log.Error().Err(err).Msgf("failed to publish message %s into %s", msg.Uid, msg.SubjectName)
+	for i, msg := range msgs {
+		var res mqClient.PublishResult
+		if i < len(results) {
+			res = results[i]
+		} else {
+			res.Err = errNoPublishResult
+		}
 
-					msg.UpdatedAt = time.Now().UTC()
-					msg.LastErrorMessage = err.Error()
-				} else {
-					msg.SendAt = time.Now().UTC()
-					log.Info().Msgf("successfuly send message %s into %s", msg.Uid, msg.SubjectName)
-				}
+		now := time.Now().UTC()
+		msg.LockedBy, msg.LockedUntil = "", time.Time{}
+		if res.Err != nil {
+			msg.Attempts++
+			msg.UpdatedAt = now
+			msg.LastErrorMessage = res.Err.Error()
 
-				if err := w.outboxRepository.UpdateMessage(ctx, msg); err != nil {
-					log.Error().Msgf("failed to update message %s: %v", msg.Uid, err)
-				}
+			if msg.Attempts >= w.maxAttempts {
+				msg.FailedAt = now
+				log.Error().Err(res.Err).Msgf("failed to publish message %s into %s, attempts exhausted (%d), message marked as failed", msg.Uid, msg.SubjectName, msg.Attempts)
+			} else {
+				msg.NextAttemptAt = now.Add(w.retryBackoff.Delay(uint64(msg.Attempts)))
+				log.Error().Err(res.Err).Msgf("failed to publish message %s into %s (attempt %d), next attempt at %s", msg.Uid, msg.SubjectName, msg.Attempts, msg.NextAttemptAt)
+			}
+		} else {
+			msg.SendAt = now
+			if res.Ack.Duplicate {
+				log.Info().Msgf("message %s already published into %s, duplicate dropped by broker", msg.Uid, msg.SubjectName)
+			} else {
+				log.Info().Msgf("successfuly send message %s into %s", msg.Uid, msg.SubjectName)
 			}
+		}
 
-			timer.Reset(w.cfg.MqPublishMessagesInterval())
+		if err := w.outboxRepository.UpdateMessage(ctx, msg); err != nil {
+			log.Error().Msgf("failed to update message %s: %v", msg.Uid, err)
 		}
 	}
 }
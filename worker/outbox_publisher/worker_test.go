@@ -0,0 +1,177 @@
+package workerOutboxPublisher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
+	mqMemory "github.com/balobas/sport_city_common/clients/mq/memory"
+	outboxEntity "github.com/balobas/sport_city_common/entity/outbox"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	uuid "github.com/satori/go.uuid"
+)
+
+type testConfig struct {
+	maxAttempts int
+}
+
+func (c testConfig) MqPublishMessagesInterval() time.Duration { return time.Second }
+func (c testConfig) MqPublishMessagesBatchSize() int64        { return 10 }
+func (c testConfig) MqPublishMaxAttempts() int                { return c.maxAttempts }
+func (c testConfig) MqPublishRetryMinDelay() time.Duration    { return time.Minute }
+func (c testConfig) MqPublishRetryMaxDelay() time.Duration    { return time.Hour }
+
+type fakeRepository struct {
+	claimed []outboxEntity.Message
+	updated map[uuid.UUID]outboxEntity.Message
+}
+
+func (r *fakeRepository) ClaimMessagesForPublish(ctx context.Context, owner string, lease time.Duration, batchSize int64) ([]outboxEntity.Message, error) {
+	msgs := make([]outboxEntity.Message, len(r.claimed))
+	for i, msg := range r.claimed {
+		msg.LockedBy, msg.LockedUntil = owner, time.Now().Add(lease)
+		msgs[i] = msg
+	}
+	return msgs, nil
+}
+
+func (r *fakeRepository) UpdateMessage(ctx context.Context, msg outboxEntity.Message) error {
+	r.updated[msg.Uid] = msg
+	return nil
+}
+
+func newOutboxMessage(subject string, attempts int) outboxEntity.Message {
+	return outboxEntity.Message{
+		Uid:         uuid.NewV4(),
+		SubjectName: subject,
+		Payload:     []byte(`{}`),
+		Attempts:    attempts,
+	}
+}
+
+func runBatch(t *testing.T, cfg Config, publisher Publisher, msgs ...outboxEntity.Message) *fakeRepository {
+	t.Helper()
+
+	repo := &fakeRepository{claimed: msgs, updated: map[uuid.UUID]outboxEntity.Message{}}
+	New(cfg, repo, publisher).publishReady(context.Background(), zerolog.Nop(), cfg.MqPublishMessagesBatchSize())
+	if len(repo.updated) != len(msgs) {
+		t.Fatalf("updated %d messages, want %d", len(repo.updated), len(msgs))
+	}
+	return repo
+}
+
+func TestPublishReadySuccess(t *testing.T) {
+	publisher := mqMemory.New()
+	msg := newOutboxMessage("media.usage", 2)
+	msg.PartitionKey = "media-1"
+	msg.Headers = map[string][]string{"X-Test": {"1"}}
+
+	before := time.Now().UTC()
+	repo := runBatch(t, testConfig{maxAttempts: 5}, publisher, msg)
+
+	got := repo.updated[msg.Uid]
+	if got.SendAt.Before(before) {
+		t.Errorf("SendAt = %s, want set after publish", got.SendAt)
+	}
+	if got.Attempts != 2 || !got.FailedAt.IsZero() || len(got.LastErrorMessage) != 0 {
+		t.Errorf("attempts = %d, failedAt = %s, lastError = %q, want unchanged", got.Attempts, got.FailedAt, got.LastErrorMessage)
+	}
+	if len(got.LockedBy) != 0 || !got.LockedUntil.IsZero() {
+		t.Errorf("lease not released: %s until %s", got.LockedBy, got.LockedUntil)
+	}
+
+	published := publisher.Published("media.usage")
+	if len(published) != 1 {
+		t.Fatalf("published %d messages, want 1", len(published))
+	}
+	if published[0].MsgId != msg.Uid.String() {
+		t.Errorf("MsgId = %q, want %q", published[0].MsgId, msg.Uid.String())
+	}
+	headers := mqClient.Meta{Headers: published[0].Headers}
+	if headers.Header(mqClient.HeaderPartitionKey) != "media-1" || headers.Header("X-Test") != "1" {
+		t.Errorf("headers = %v", published[0].Headers)
+	}
+	if _, ok := msg.Headers[mqClient.HeaderPartitionKey]; ok {
+		t.Error("partition key written into message headers")
+	}
+}
+
+func TestPublishReadyFailureSchedulesRetry(t *testing.T) {
+	publisher := mqMemory.New()
+	publisher.InjectPublishFailure("media.usage", errors.New("broker down"), 1)
+	msg := newOutboxMessage("media.usage", 0)
+
+	before := time.Now().UTC()
+	repo := runBatch(t, testConfig{maxAttempts: 5}, publisher, msg)
+
+	got := repo.updated[msg.Uid]
+	if got.Attempts != 1 || !got.SendAt.IsZero() || !got.FailedAt.IsZero() {
+		t.Errorf("attempts = %d, sendAt = %s, failedAt = %s, want one failed attempt", got.Attempts, got.SendAt, got.FailedAt)
+	}
+	if got.LastErrorMessage != "broker down" {
+		t.Errorf("LastErrorMessage = %q", got.LastErrorMessage)
+	}
+	// первая задержка MqPublishRetryMinDelay с jitter до 20%
+	if got.NextAttemptAt.Before(before.Add(48*time.Second)) || got.NextAttemptAt.After(time.Now().UTC().Add(time.Minute)) {
+		t.Errorf("NextAttemptAt = %s, want about a minute after %s", got.NextAttemptAt, before)
+	}
+	if len(got.LockedBy) != 0 || !got.LockedUntil.IsZero() {
+		t.Errorf("lease not released: %s until %s", got.LockedBy, got.LockedUntil)
+	}
+}
+
+func TestPublishReadyAttemptsExhausted(t *testing.T) {
+	publisher := mqMemory.New()
+	publisher.InjectPublishFailure("media.usage", errors.New("broker down"), 1)
+	msg := newOutboxMessage("media.usage", 2)
+
+	repo := runBatch(t, testConfig{maxAttempts: 3}, publisher, msg)
+
+	got := repo.updated[msg.Uid]
+	if got.Attempts != 3 || got.FailedAt.IsZero() || !got.SendAt.IsZero() {
+		t.Errorf("attempts = %d, failedAt = %s, sendAt = %s, want message marked as failed", got.Attempts, got.FailedAt, got.SendAt)
+	}
+}
+
+func TestPublishReadyPartialBatch(t *testing.T) {
+	publisher := mqMemory.New()
+	publisher.InjectPublishFailure("media.deleted", errors.New("broker down"), 1)
+	sent := newOutboxMessage("media.usage", 0)
+	failed := newOutboxMessage("media.deleted", 0)
+
+	repo := runBatch(t, testConfig{maxAttempts: 5}, publisher, sent, failed)
+
+	if got := repo.updated[sent.Uid]; got.SendAt.IsZero() || got.Attempts != 0 {
+		t.Errorf("sent message: sendAt = %s, attempts = %d", got.SendAt, got.Attempts)
+	}
+	if got := repo.updated[failed.Uid]; !got.SendAt.IsZero() || got.Attempts != 1 {
+		t.Errorf("failed message: sendAt = %s, attempts = %d", got.SendAt, got.Attempts)
+	}
+}
+
+// shortPublisher возвращает результат только для первого сообщения батча
+type shortPublisher struct{}
+
+func (p shortPublisher) Publish(ctx context.Context, subjectName string, data []byte) error {
+	return nil
+}
+
+func (p shortPublisher) PublishBatch(ctx context.Context, msgs []mqClient.PublishMsg) []mqClient.PublishResult {
+	return make([]mqClient.PublishResult, 1)
+}
+
+func TestPublishReadyMissingResultsFail(t *testing.T) {
+	first := newOutboxMessage("media.usage", 0)
+	second := newOutboxMessage("media.usage", 0)
+
+	repo := runBatch(t, testConfig{maxAttempts: 5}, shortPublisher{}, first, second)
+
+	if got := repo.updated[first.Uid]; got.SendAt.IsZero() {
+		t.Error("message with result not marked as sent")
+	}
+	if got := repo.updated[second.Uid]; !got.SendAt.IsZero() || got.Attempts != 1 || len(got.LastErrorMessage) == 0 {
+		t.Errorf("message without result: sendAt = %s, attempts = %d, lastError = %q", got.SendAt, got.Attempts, got.LastErrorMessage)
+	}
+}
@@ -4,6 +4,11 @@ import (
 	"context"
 )
 
+/*
+Publisher
+Реализуется любым mqClient.MqClient. Если publisher реализует mqClient.MsgPublisher,
+сообщение публикуется с MsgId для дедупликации на стороне брокера
+*/
 type Publisher interface {
 	Publish(ctx context.Context, subjectName string, data []byte) error
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	mqClient "github.com/balobas/sport_city_common/clients/mq"
 	outboxEntity "github.com/balobas/sport_city_common/entity/outbox"
 	"github.com/balobas/sport_city_common/logger"
 	"github.com/riverqueue/river"
@@ -48,9 +49,17 @@ func (w *Worker) Work(ctx context.Context, job *river.Job[Args]) error {
 
 	msg := job.Args.Message
 
-	if err := w.publisher.Publish(ctx, msg.SubjectName, msg.Payload); err != nil {
+	ack, err := mqClient.PublishMessage(ctx, w.publisher, mqClient.PublishMsg{
+		Subject: msg.SubjectName,
+		Data:    msg.Payload,
+		MsgId:   msg.Uid.String(),
+	})
+	if err != nil {
 		log.Error().Err(err).Msgf("failed to publish message %s into %s", msg.Uid, msg.SubjectName)
 		return err
 	}
+	if ack.Duplicate {
+		log.Info().Msgf("message %s already published into %s, duplicate dropped by broker", msg.Uid, msg.SubjectName)
+	}
 	return nil
 }